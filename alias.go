@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/andrewpillar/query"
+)
+
+// Alias is an alternative name for an image of a driver, for example
+// debian/stable. An alias either points to the image with the target name, or
+// to the most recently modified image whose name matches the latest pattern,
+// in the same category as the alias. If redirect is true then requests for
+// the alias are redirected to the image, otherwise the image is served under
+// the name of the alias.
+type Alias struct {
+	Name     string `json:"name"`
+	Target   string `json:"target,omitempty"`
+	Latest   string `json:"latest,omitempty"`
+	Redirect bool   `json:"redirect"`
+}
+
+func (a Alias) validate() error {
+	if a.Name == "" {
+		return errors.New("alias has no name")
+	}
+
+	if (a.Target == "") == (a.Latest == "") {
+		return errors.New("alias " + a.Name + " must have either a target or a latest pattern")
+	}
+
+	if a.Latest != "" {
+		if _, err := filepath.Match(a.Latest, ""); err != nil {
+			return errors.New("alias " + a.Name + " has an invalid pattern " + a.Latest)
+		}
+	}
+	return nil
+}
+
+// alias returns the alias of the driver with the given name.
+func (d driver) alias(name string) (Alias, bool) {
+	for _, a := range d.aliases {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Alias{}, false
+}
+
+// ResolveAlias returns the image the given alias points to in the given driver
+// and category. Images that are symbolic links are never matched by the latest
+// pattern of an alias.
+func (db DB) ResolveAlias(driver, category string, a Alias) (*Image, bool, error) {
+	if a.Target != "" {
+		return db.Image(driver, category, a.Target)
+	}
+
+	// The pattern is matched with filepath.Match rather than GLOB, so that *
+	// does not match a / in the name, the same as when it was validated.
+	imgs, err := db.Images(
+		query.Where("driver", "=", query.Arg(driver)),
+		query.Where("category", "=", query.Arg(category)),
+		query.Where("link", "=", query.Arg("")),
+		query.OrderDesc("mod_time DESC", "path"),
+	)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, img := range imgs {
+		if ok, _ := filepath.Match(a.Latest, img.Name); ok {
+			return img, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// image returns the image with the given name, if there is no such image then
+// the targets of symbolic links, and then the aliases of the driver are
+// checked for the name. The alias the image was resolved from is returned if
+// the image was found through an alias.
+func (s *Server) image(driver, category, name string) (*Image, *Alias, bool, error) {
+	img, ok, err := s.DB.Image(driver, category, name)
+
+	if err != nil || ok {
+		return img, nil, ok, err
+	}
+
+	img, ok, err = s.DB.LinkTarget(driver, category, name)
+
+	if err != nil || ok {
+		return img, nil, ok, err
+	}
+
+	d, ok := s.Scanner.drivers[driver]
+
+	if !ok {
+		return nil, nil, false, nil
+	}
+
+	a, ok := d.alias(name)
+
+	if !ok {
+		return nil, nil, false, nil
+	}
+
+	img, ok, err = s.DB.ResolveAlias(driver, category, a)
+
+	if err != nil || !ok {
+		return nil, nil, ok, err
+	}
+
+	img.Alias = a.Name
+	img.Manifest = newManifest(img)
+
+	return img, &a, true, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveAliasLatest(t *testing.T) {
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	now := time.Now()
+
+	// Each image is a day newer than the one before it.
+	imgs := []*Image{
+		{Name: "alpine/3.17"},
+		{Name: "alpine/3.18"},
+		{Name: "alpine/3.19/rc1"},
+		{Name: "alpine/3.20", Link: "alpine/3.18"},
+	}
+
+	for i, img := range imgs {
+		img.Path = "/images/qemu/x86_64/" + img.Name
+		img.Driver = "qemu"
+		img.Category = "x86_64"
+		img.ModTime = now.AddDate(0, 0, i)
+	}
+
+	if err := db.Load(imgs); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		latest string
+		want   string
+	}{
+		{"alpine/*", "alpine/3.18"},
+		{"alpine/3.1[0-7]", "alpine/3.17"},
+		{"alpine/*/*", "alpine/3.19/rc1"},
+		{"debian/*", ""},
+	}
+
+	for _, test := range tests {
+		a := Alias{Name: "alpine/latest", Latest: test.latest}
+
+		if err := a.validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		img, ok, err := db.ResolveAlias("qemu", "x86_64", a)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			if test.want != "" {
+				t.Errorf("%s: expected %s, got nothing", test.latest, test.want)
+			}
+			continue
+		}
+
+		if img.Name != test.want {
+			t.Errorf("%s: expected %s, got %s", test.latest, test.want, img.Name)
+		}
+	}
+
+	if err := (Alias{Name: "alpine/latest", Latest: "alpine/["}).validate(); err == nil {
+		t.Error("expected invalid pattern to fail validation")
+	}
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// apiPrefix is the prefix of every endpoint in the current version of the
+// API.
+const apiPrefix = "/api/v1"
+
+// apiResponse is the envelope for every successful response from the API. The
+// data is the resource being requested, and the links are the URLs for the
+// next and previous pages, if the resource is paginated.
+type apiResponse struct {
+	Data  interface{}       `json:"data"`
+	Links map[string]string `json:"links,omitempty"`
+}
+
+// Problem is the body of an error response from the API, as described in
+// RFC 7807.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// apiImage is the representation of an image in the API, this includes the
+// URL from which the image can be downloaded.
+type apiImage struct {
+	*Image
+
+	URL string `json:"url"`
+}
+
+type apiDriver struct {
+	Name       string   `json:"name"`
+	Categories []string `json:"categories"`
+	Groups     []string `json:"groups"`
+	Images     int      `json:"images"`
+}
+
+type apiCategory struct {
+	Driver string `json:"driver"`
+	Name   string `json:"name"`
+	Images int    `json:"images"`
+}
+
+type apiGroup struct {
+	Driver string `json:"driver"`
+	Name   string `json:"name"`
+	Images int    `json:"images"`
+}
+
+type apiTag struct {
+	Name   string `json:"name"`
+	Images int64  `json:"images"`
+}
+
+// apiAlias is the representation of an alias in a category of a driver, along
+// with the image the alias currently points to, if any.
+type apiAlias struct {
+	Alias
+
+	Driver   string    `json:"driver"`
+	Category string    `json:"category"`
+	Image    *apiImage `json:"image"`
+}
+
+// apiTree is the representation of a node in the Tree of images, along with
+// the number of images beneath it.
+type apiTree struct {
+	Name     string    `json:"name"`
+	Images   int       `json:"images"`
+	Children []apiTree `json:"children,omitempty"`
+}
+
+func apiImages(imgs []*Image) []apiImage {
+	aa := make([]apiImage, 0, len(imgs))
+
+	for _, img := range imgs {
+		aa = append(aa, apiImage{
+			Image: img,
+			URL:   img.Endpoint(),
+		})
+	}
+	return aa
+}
+
+func (s *Server) apiJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+// apiError writes a problem response with the given status, and detail of the
+// problem.
+func (s *Server) apiError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// sortedDrivers returns the drivers configured for the scanner sorted by name.
+func (s *Server) sortedDrivers() []driver {
+	dd := make([]driver, 0, len(s.Scanner.drivers))
+
+	for _, d := range s.Scanner.drivers {
+		dd = append(dd, d)
+	}
+
+	sort.Slice(dd, func(i, j int) bool {
+		return dd[i].name < dd[j].name
+	})
+	return dd
+}
+
+// catalog is the number of images in each group of each category of each
+// driver.
+type catalog []ImageCount
+
+// catalog returns the catalog of the images in the database, this only counts
+// the images rather than loading each of them.
+func (s *Server) catalog() (catalog, error) {
+	counts, err := s.DB.ImageCounts()
+
+	if err != nil {
+		return nil, err
+	}
+	return catalog(counts), nil
+}
+
+// tree returns the Tree of the catalog, whereby each sub-tree counts the
+// images beneath it.
+func (c catalog) tree() *Tree {
+	var tree Tree
+
+	for _, count := range c {
+		tree.PutCount(count.Driver, count.Category, count.Group, count.Images)
+	}
+	return &tree
+}
+
+// count returns the number of images in the catalog whose counts match the
+// given function.
+func (c catalog) count(match func(ImageCount) bool) int {
+	n := 0
+
+	for _, count := range c {
+		if match(count) {
+			n += count.Images
+		}
+	}
+	return n
+}
+
+func (d driver) categoryNames() []string {
+	names := make([]string, 0, len(d.categories))
+
+	for name := range d.categories {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (d driver) api(c catalog) apiDriver {
+	groups := make([]string, 0, len(d.groups))
+
+	for _, grp := range d.groups {
+		groups = append(groups, grp.name)
+	}
+
+	return apiDriver{
+		Name:       d.name,
+		Categories: d.categoryNames(),
+		Groups:     groups,
+		Images: c.count(func(count ImageCount) bool {
+			return count.Driver == d.name
+		}),
+	}
+}
+
+func (t *Tree) api() apiTree {
+	children := make([]apiTree, 0, len(t.children))
+
+	for _, child := range t.Children() {
+		children = append(children, child.api())
+	}
+
+	return apiTree{
+		Name:     t.name,
+		Images:   t.Count(),
+		Children: children,
+	}
+}
+
+// apiRoute is an endpoint in the API. The path of a route is made up of
+// segments, a segment wrapped in braces is a parameter that matches any
+// single segment, unless it is suffixed with ..., in which case it matches
+// every remaining segment. Each route carries the operation that documents it
+// in the OpenAPI document, so a route cannot be served without being
+// documented.
+type apiRoute struct {
+	path    string
+	op      specOperation
+	handler func(s *Server, w http.ResponseWriter, r *http.Request, params map[string]string)
+}
+
+// match returns the parameters for the route from the given path, and whether
+// the path matched the route.
+func (rt apiRoute) match(path string) (map[string]string, bool) {
+	want := strings.Split(strings.Trim(rt.path, "/"), "/")
+	have := strings.Split(strings.Trim(path, "/"), "/")
+
+	params := make(map[string]string)
+
+	for i, seg := range want {
+		if i >= len(have) || have[i] == "" {
+			return nil, false
+		}
+
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			name := strings.Trim(seg, "{}")
+
+			if strings.HasSuffix(name, "...") {
+				params[strings.TrimSuffix(name, "...")] = strings.Join(have[i:], "/")
+				return params, true
+			}
+			params[name] = have[i]
+			continue
+		}
+
+		if seg != have[i] {
+			return nil, false
+		}
+	}
+	return params, len(want) == len(have)
+}
+
+// apiRoutes are the routes of the API, these are matched in order.
+var apiRoutes = []apiRoute{
+	{
+		path:    "/images",
+		op:      imagesOperation,
+		handler: (*Server).apiImages,
+	},
+	{
+		path:    "/images/{driver}/{image...}",
+		op:      imageOperation,
+		handler: (*Server).apiImage,
+	},
+	{
+		path:    "/drivers",
+		op:      driversOperation,
+		handler: (*Server).apiDrivers,
+	},
+	{
+		path:    "/drivers/{driver}",
+		op:      driverOperation,
+		handler: (*Server).apiDriver,
+	},
+	{
+		path:    "/categories",
+		op:      categoriesOperation,
+		handler: (*Server).apiCategories,
+	},
+	{
+		path:    "/groups",
+		op:      groupsOperation,
+		handler: (*Server).apiGroups,
+	},
+	{
+		path:    "/tags",
+		op:      tagsOperation,
+		handler: (*Server).apiTags,
+	},
+	{
+		path:    "/aliases",
+		op:      aliasesOperation,
+		handler: (*Server).apiAliases,
+	},
+	{
+		path:    "/tree",
+		op:      treeOperation,
+		handler: (*Server).apiTree,
+	},
+}
+
+// API serves the versioned JSON API. Every response is wrapped in an envelope,
+// and every error is a problem as described in RFC 7807. The endpoints served
+// are those in apiRoutes, along with the OpenAPI document describing them at
+// /api/v1/openapi.json.
+func (s *Server) API(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.apiError(w, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+
+	if path == "/openapi.json" {
+		s.apiJSON(w, http.StatusOK, OpenAPI())
+		return
+	}
+
+	for _, rt := range apiRoutes {
+		if params, ok := rt.match(path); ok {
+			rt.handler(s, w, r, params)
+			return
+		}
+	}
+	s.apiError(w, http.StatusNotFound, "no such endpoint "+r.URL.Path)
+}
+
+func (s *Server) apiDrivers(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	c, err := s.catalog()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	dd := make([]apiDriver, 0, len(s.Scanner.drivers))
+
+	for _, d := range s.sortedDrivers() {
+		dd = append(dd, d.api(c))
+	}
+	s.apiJSON(w, http.StatusOK, apiResponse{Data: dd})
+}
+
+func (s *Server) apiDriver(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	d, ok := s.Scanner.drivers[params["driver"]]
+
+	if !ok {
+		s.apiError(w, http.StatusNotFound, "no such driver "+params["driver"])
+		return
+	}
+
+	c, err := s.catalog()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+	s.apiJSON(w, http.StatusOK, apiResponse{Data: d.api(c)})
+}
+
+func (s *Server) apiCategories(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	c, err := s.catalog()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	name := r.URL.Query().Get("driver")
+	cc := make([]apiCategory, 0)
+
+	for _, d := range s.sortedDrivers() {
+		if name != "" && d.name != name {
+			continue
+		}
+
+		for _, category := range d.categoryNames() {
+			// Images in categories nested within the category are not
+			// counted.
+			n := c.count(func(count ImageCount) bool {
+				return count.Driver == d.name && count.Category == category
+			})
+
+			cc = append(cc, apiCategory{
+				Driver: d.name,
+				Name:   category,
+				Images: n,
+			})
+		}
+	}
+	s.apiJSON(w, http.StatusOK, apiResponse{Data: cc})
+}
+
+func (s *Server) apiGroups(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	c, err := s.catalog()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	name := r.URL.Query().Get("driver")
+	gg := make([]apiGroup, 0)
+
+	for _, d := range s.sortedDrivers() {
+		if name != "" && d.name != name {
+			continue
+		}
+
+		for _, grp := range d.groups {
+			n := c.count(func(count ImageCount) bool {
+				return count.Driver == d.name && count.Group == grp.name
+			})
+
+			gg = append(gg, apiGroup{
+				Driver: d.name,
+				Name:   grp.name,
+				Images: n,
+			})
+		}
+	}
+	s.apiJSON(w, http.StatusOK, apiResponse{Data: gg})
+}
+
+// apiTags serves every tag in the catalog, sorted by name.
+func (s *Server) apiTags(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	tags, err := s.DB.Tags()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	tt := make([]apiTag, 0, len(tags))
+
+	for name, n := range tags {
+		tt = append(tt, apiTag{
+			Name:   name,
+			Images: n,
+		})
+	}
+
+	sort.Slice(tt, func(i, j int) bool {
+		return tt[i].Name < tt[j].Name
+	})
+	s.apiJSON(w, http.StatusOK, apiResponse{Data: tt})
+}
+
+// apiAliases serves the aliases of each driver, resolved in each category of
+// the driver.
+func (s *Server) apiAliases(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	name := r.URL.Query().Get("driver")
+	aa := make([]apiAlias, 0)
+
+	for _, d := range s.sortedDrivers() {
+		if name != "" && d.name != name {
+			continue
+		}
+
+		categories := d.categoryNames()
+
+		if len(categories) == 0 {
+			categories = []string{""}
+		}
+
+		for _, a := range d.aliases {
+			for _, category := range categories {
+				alias := apiAlias{
+					Alias:    a,
+					Driver:   d.name,
+					Category: category,
+				}
+
+				img, ok, err := s.DB.ResolveAlias(d.name, category, a)
+
+				if err != nil {
+					s.InternalServerError(w, r, err)
+					return
+				}
+
+				if ok {
+					alias.Image = &apiImage{
+						Image: img,
+						URL:   img.Endpoint(),
+					}
+				}
+				aa = append(aa, alias)
+			}
+		}
+	}
+	s.apiJSON(w, http.StatusOK, apiResponse{Data: aa})
+}
+
+// apiTree serves the Tree of images, with the number of images beneath each
+// node. This can be narrowed down to a single driver via the driver query
+// parameter.
+func (s *Server) apiTree(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	c, err := s.catalog()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	tree := c.tree()
+
+	if name := r.URL.Query().Get("driver"); name != "" {
+		dt, ok := tree.Get(name)
+
+		if !ok {
+			if _, ok := s.Scanner.drivers[name]; !ok {
+				s.apiError(w, http.StatusNotFound, "no such driver "+name)
+				return
+			}
+			dt = &Tree{name: name}
+		}
+		s.apiJSON(w, http.StatusOK, apiResponse{Data: dt.api()})
+		return
+	}
+	s.apiJSON(w, http.StatusOK, apiResponse{Data: tree.api()})
+}
+
+func (s *Server) apiImages(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+	q := r.URL.Query()
+
+	opts, err := searchOpts(q)
+
+	if err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pg, err := ParsePage(q)
+
+	if err != nil {
+		s.apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imgs, err := s.DB.Images(append(opts, pg.Options()...)...)
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	imgs = pg.Images(imgs)
+
+	resp := apiResponse{
+		Data: apiImages(imgs),
+	}
+
+	pg.SetLinkHeader(w, r)
+
+	if links := pg.Links(r); len(links) > 0 {
+		resp.Links = links
+	}
+	s.apiJSON(w, http.StatusOK, resp)
+}
+
+// apiImage serves the metadata of an image. The leading parts of the image's
+// path are only treated as the image's category if they are a category
+// configured for the image's driver.
+func (s *Server) apiImage(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	driver := params["driver"]
+
+	if _, ok := s.Scanner.drivers[driver]; !ok {
+		s.apiError(w, http.StatusNotFound, "no such driver "+driver)
+		return
+	}
+
+	category, name := s.Scanner.splitName(driver, strings.Split(params["image"], "/"))
+
+	img, _, ok, err := s.image(driver, category, name)
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	if !ok {
+		s.apiError(w, http.StatusNotFound, "no such image "+name)
+		return
+	}
+
+	s.apiJSON(w, http.StatusOK, apiResponse{
+		Data: apiImage{
+			Image: img,
+			URL:   img.Endpoint(),
+		},
+	})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestOpenAPIPaths checks that each path in the OpenAPI document is served,
+// with the status and Content-Type the document gives for it.
+func TestOpenAPIPaths(t *testing.T) {
+	srv := httptest.NewServer(testServer(t).routes())
+	defer srv.Close()
+
+	paths := OpenAPI()["paths"].(map[string]interface{})
+
+	keys := make([]string, 0, len(paths))
+
+	for path := range paths {
+		keys = append(keys, path)
+	}
+	sort.Strings(keys)
+
+	// The values substituted into each path, first for a request that should
+	// succeed, and then for one that should not be found.
+	found := strings.NewReplacer("{driver}", "qemu", "{image}", "x86_64/debian/12")
+	missing := strings.NewReplacer("{driver}", "nope", "{image}", "x86_64/debian/1")
+
+	for _, path := range keys {
+		op := paths[path].(map[string]interface{})["get"].(map[string]interface{})
+		responses := op["responses"].(map[string]interface{})
+
+		// Each Content-Type of the response is asked for in turn, and
+		// should be the one that is served.
+		check := func(url, status string) {
+			content := responses[status].(map[string]interface{})["content"].(map[string]interface{})
+
+			for typ := range content {
+				req, err := http.NewRequest("GET", srv.URL+url, nil)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				req.Header.Set("Accept", typ)
+
+				resp, err := http.DefaultClient.Do(req)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				resp.Body.Close()
+
+				if got := strconv.Itoa(resp.StatusCode); got != status {
+					t.Errorf("%s: expected status %s, got %s", url, status, got)
+					continue
+				}
+
+				got, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+				if err != nil {
+					t.Errorf("%s: %s", url, err)
+					continue
+				}
+
+				if got != typ {
+					t.Errorf("%s: expected Content-Type %s for status %s, got %s", url, typ, status, got)
+				}
+			}
+		}
+
+		check(found.Replace(path), "200")
+
+		if _, ok := responses["404"]; ok && strings.Contains(path, "{") {
+			check(missing.Replace(path), "404")
+		}
+	}
+}
+
+func TestAPICategories(t *testing.T) {
+	h := testServer(t).routes()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/categories", nil))
+
+	var resp struct {
+		Data []apiCategory
+	}
+
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// The images in x86_64/uefi are not counted in x86_64.
+	expected := map[string]int{
+		"x86_64":      3,
+		"x86_64/uefi": 1,
+	}
+
+	if len(resp.Data) != len(expected) {
+		t.Fatalf("expected %d categories, got %d", len(expected), len(resp.Data))
+	}
+
+	for _, c := range resp.Data {
+		if n := expected[c.Name]; c.Images != n {
+			t.Errorf("%s: expected %d images, got %d", c.Name, n, c.Images)
+		}
+	}
+}
+
+func TestAPIImagesPagination(t *testing.T) {
+	s := testServer(t)
+	h := s.routes()
+
+	for _, sort := range []string{"", "name", "mod_time", "size"} {
+		seen := make(map[string]struct{})
+		url := "/api/v1/images?limit=2&sort=" + sort
+
+		for url != "" {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("%s: expected status %d, got %d", url, http.StatusOK, rec.Code)
+			}
+
+			var resp struct {
+				Data  []*Image
+				Links map[string]string
+			}
+
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, img := range resp.Data {
+				key := img.Category + "/" + img.Name
+
+				if _, ok := seen[key]; ok {
+					t.Errorf("sort=%s: image %s seen twice", sort, key)
+				}
+				seen[key] = struct{}{}
+			}
+
+			url = resp.Links["next"]
+
+			// The cursor should not reveal where the store is.
+			if url != "" {
+				after := httptest.NewRequest("GET", url, nil).URL.Query().Get("after")
+				b, _ := base64.RawURLEncoding.DecodeString(after)
+
+				if strings.Contains(string(b), s.Scanner.dir) {
+					t.Errorf("sort=%s: cursor %s contains the path of the store", sort, b)
+				}
+			}
+		}
+
+		if len(seen) != 5 {
+			t.Errorf("sort=%s: expected 5 images, got %d", sort, len(seen))
+		}
+	}
+}
@@ -4,20 +4,31 @@ import (
 	"crypto/tls"
 	"errors"
 	"io"
+	"log/syslog"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/andrewpillar/config"
 )
 
+// logRotateConfig is when the log files are rotated, either once they exceed
+// the given size, or have been open for the given amount of time.
+type logRotateConfig struct {
+	Size int64
+	Age  time.Duration
+}
+
 type serverConfig struct {
 	Pidfile string
 
 	Net struct {
 		Listen string
+		URL    string `config:"url"`
 
 		WriteTimeout time.Duration `config:"write_timeout"`
 		ReadTimeout  time.Duration `config:"read_timeout"`
@@ -28,22 +39,74 @@ type serverConfig struct {
 		}
 	}
 
-	Log map[string]string
+	Log       map[string]string
+	LogRotate logRotateConfig `config:"log_rotate"`
 
 	Store struct {
-		Path string
+		Path     string
+		Database string
+
+		ScanInterval    time.Duration `config:"scan_interval"`
+		FeedMaxAge      time.Duration `config:"feed_max_age"`
+		DownloadsMaxAge time.Duration `config:"downloads_max_age"`
+
+		Retention struct {
+			MaxAge time.Duration `config:"max_age"`
+			Unused time.Duration
+			Keep   int64
+		}
+	}
+
+	UI struct {
+		Title string
+		Logo  string
+		CSS   string `config:"css"`
 
-		ScanInterval time.Duration `config:"scan_interval"`
+		Links []struct {
+			Name string
+			URL  string `config:"url"`
+		}
 	}
 
 	Driver map[string]struct {
 		Categories []string
 
 		Groups []struct {
+			Name     string
+			Pattern  string
+			Match    []string
+			Exclude  []string
+			Priority int64
+		}
+
+		Aliases []struct {
+			Name     string
+			Target   string
+			Latest   string
+			Redirect bool
+		}
+
+		Tags []struct {
 			Name    string
-			Pattern string
+			Match   []string
+			Exclude []string
 		}
+
+		RedirectLinks bool   `config:"redirect_links"`
+		CacheControl  string `config:"cache_control"`
+	}
+}
+
+// decodeConfig decodes the given config file.
+func decodeConfig(f *os.File) (serverConfig, error) {
+	var cfg serverConfig
+
+	dec := config.NewDecoder(f.Name())
+
+	if err := dec.Decode(&cfg, f); err != nil {
+		return cfg, err
 	}
+	return cfg, nil
 }
 
 var drivers = map[string]struct{}{
@@ -69,50 +132,297 @@ func mkpidfile(path string) (string, error) {
 	return pidfile.Name(), nil
 }
 
-var logmask = os.O_WRONLY | os.O_APPEND | os.O_CREATE
+var syslogPriorities = map[LogLevel]syslog.Priority{
+	Debug: syslog.LOG_DEBUG,
+	Info:  syslog.LOG_INFO,
+	Warn:  syslog.LOG_WARNING,
+	Error: syslog.LOG_ERR,
+}
+
+// logger returns a Logger that writes each level to the destinations
+// configured for it. A destination configured for a level receives the
+// entries for that level and every level above it. A destination can either
+// be a file, "stdout", "stderr", or "syslog". The format label sets the format
+// of each entry, any other label that is not a level is an error.
+func logger(cfg map[string]string, rotate logRotateConfig) (*Logger, error) {
+	logtab := make(map[LogLevel]string)
 
-func logger(logtab map[string]string) (*Logger, error) {
-	var (
-		level LogLevel
-		file  string
-	)
+	var format string
+
+	for label, val := range cfg {
+		if strings.EqualFold(label, "format") {
+			format = val
+			continue
+		}
 
-	for label, val := range logtab {
-		lvl, ok := LogLevels[label]
+		lvl, ok := LogLevels[strings.ToLower(label)]
 
 		if !ok {
 			return nil, errors.New("unknown log level " + label)
 		}
+		logtab[lvl] = val
+	}
+
+	var level LogLevel
 
-		if lvl <= level || level == 0 {
+	for lvl, dst := range logtab {
+		if dst == "" {
+			continue
+		}
+
+		if lvl < level || level == 0 {
 			level = lvl
-			file = val
 		}
 	}
 
+	if level == 0 {
+		level = Info
+		logtab[Info] = os.Stdout.Name()
+	}
+
 	log := NewLog(os.Stdout)
+	log.ClearWriters()
 	log.SetLevel(level.String())
 
-	if file != os.Stdout.Name() {
-		f, err := os.OpenFile(file, logmask, 0640)
+	if format != "" {
+		if format != "text" && format != "json" {
+			return nil, errors.New("unknown log format " + format)
+		}
+		log.SetFormat(format)
+	}
+
+	files := make(map[string]io.Writer)
+
+	open := func(dst string, lvl LogLevel) (io.Writer, error) {
+		switch dst {
+		case "stdout", os.Stdout.Name():
+			return os.Stdout, nil
+		case "stderr", os.Stderr.Name():
+			return os.Stderr, nil
+		case "syslog":
+			// Each level is written with its own priority, so it needs its
+			// own connection to syslog.
+			return syslog.New(syslogPriorities[lvl]|syslog.LOG_DAEMON, "djinn-imgsrv")
+		}
+
+		if w, ok := files[dst]; ok {
+			return w, nil
+		}
+
+		f, err := OpenLogFile(dst, rotate.Size, rotate.Age)
 
 		if err != nil {
 			return nil, err
 		}
-		log.SetWriter(f)
+
+		files[dst] = f
+		return f, nil
 	}
 
-	log.Info.Println("logging initialized, writing to", file, "at level", level.String())
+	for _, lvl := range []LogLevel{Debug, Info, Warn, Error} {
+		// Only write an entry to a destination once, even if that destination
+		// has been configured for multiple levels.
+		seen := make(map[string]struct{})
+
+		for thresh := Debug; thresh <= lvl; thresh++ {
+			dst := logtab[thresh]
+
+			if dst == "" {
+				continue
+			}
 
+			if _, ok := seen[dst]; ok {
+				continue
+			}
+
+			seen[dst] = struct{}{}
+
+			w, err := open(dst, lvl)
+
+			if err != nil {
+				log.Close()
+				return nil, err
+			}
+			log.AddWriter(lvl, w)
+		}
+	}
+
+	for _, lvl := range []LogLevel{Debug, Info, Warn, Error} {
+		if dst := logtab[lvl]; dst != "" {
+			log.Info.With("dest", dst, "log_level", lvl).Println("logging initialized")
+		}
+	}
 	return log, nil
 }
 
+// scanner returns a Scanner for the store and drivers in the given config.
+// Any errors that occur during a scan are logged to the given Logger.
+func scanner(cfg serverConfig, log *Logger) (*Scanner, error) {
+	sc := &Scanner{
+		dir: cfg.Store.Path,
+		log: log,
+		errh: func(err error) {
+			l := &log.Error
+
+			var serr *scanError
+
+			if errors.As(err, &serr) {
+				l = l.With("path", serr.path, "driver", serr.driver)
+			}
+			l.With("err", err).Println("failed to scan images")
+		},
+		drivers: make(map[string]driver),
+	}
+
+	for name, cfg := range cfg.Driver {
+		if _, ok := drivers[name]; !ok {
+			return nil, errors.New("unknown driver: " + name)
+		}
+
+		categories := make(map[string]struct{})
+
+		for _, name := range cfg.Categories {
+			name = strings.Trim(name, "/")
+
+			if name == "" {
+				continue
+			}
+			categories[name] = struct{}{}
+		}
+
+		groups := make([]driverGroup, 0, len(cfg.Groups))
+
+		for _, group := range cfg.Groups {
+			rules, err := parseGroupRules(group.Match)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// The pattern of a group is an unanchored regular expression,
+			// this is kept as is for existing configurations.
+			if group.Pattern != "" {
+				re, err := regexp.Compile(group.Pattern)
+
+				if err != nil {
+					return nil, err
+				}
+
+				rules = append(rules, groupRule{
+					src:   "pattern:" + group.Pattern,
+					match: re.MatchString,
+				})
+			}
+
+			exclude, err := parseGroupRules(group.Exclude)
+
+			if err != nil {
+				return nil, err
+			}
+
+			groups = append(groups, driverGroup{
+				name:     group.Name,
+				priority: group.Priority,
+				rules:    rules,
+				exclude:  exclude,
+			})
+		}
+
+		sortGroups(groups)
+
+		tags := make([]driverGroup, 0, len(cfg.Tags))
+
+		for _, tag := range cfg.Tags {
+			rules, err := parseGroupRules(tag.Match)
+
+			if err != nil {
+				return nil, err
+			}
+
+			exclude, err := parseGroupRules(tag.Exclude)
+
+			if err != nil {
+				return nil, err
+			}
+
+			tags = append(tags, driverGroup{
+				name:    tag.Name,
+				rules:   rules,
+				exclude: exclude,
+			})
+		}
+
+		aliases := make([]Alias, 0, len(cfg.Aliases))
+
+		for _, alias := range cfg.Aliases {
+			a := Alias{
+				Name:     alias.Name,
+				Target:   alias.Target,
+				Latest:   alias.Latest,
+				Redirect: alias.Redirect,
+			}
+
+			if err := a.validate(); err != nil {
+				return nil, err
+			}
+			aliases = append(aliases, a)
+		}
+
+		sc.drivers[name] = driver{
+			name:       name,
+			categories: categories,
+			groups:     groups,
+			aliases:    aliases,
+			tags:       tags,
+
+			redirectLinks: cfg.RedirectLinks,
+			cacheControl:  cfg.CacheControl,
+		}
+	}
+	return sc, nil
+}
+
+// theme returns the Theme for the web UI in the given config. The CSS of the
+// config is the path to the stylesheet that is read in.
+func theme(cfg serverConfig) (*Theme, error) {
+	t := &Theme{
+		Title: cfg.UI.Title,
+		Logo:  cfg.UI.Logo,
+		Links: make([]ThemeLink, 0, len(cfg.UI.Links)),
+	}
+
+	if cfg.UI.CSS != "" {
+		b, err := os.ReadFile(cfg.UI.CSS)
+
+		if err != nil {
+			return nil, err
+		}
+		t.CSS = string(b)
+	}
+
+	for _, link := range cfg.UI.Links {
+		if link.Name == "" || link.URL == "" {
+			return nil, errors.New("footer link must have a name and url")
+		}
+
+		t.Links = append(t.Links, ThemeLink{
+			Name: link.Name,
+			URL:  link.URL,
+		})
+	}
+	return t, nil
+}
+
 func DecodeConfig(f *os.File) (*Server, func(), error) {
-	var cfg serverConfig
+	cfg, err := decodeConfig(f)
 
-	dec := config.NewDecoder(f.Name())
+	if err != nil {
+		return nil, nil, err
+	}
 
-	if err := dec.Decode(&cfg, f); err != nil {
+	downloadsMaxAge, err := downloadsMaxAge(cfg)
+
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -128,6 +438,20 @@ func DecodeConfig(f *os.File) (*Server, func(), error) {
 		ReadTimeout:  cfg.Net.ReadTimeout,
 	}
 
+	// The URL is used for the absolute links in the feed, otherwise these
+	// are made from the Host of each request.
+	if cfg.Net.URL != "" {
+		u, err := url.Parse(cfg.Net.URL)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return nil, nil, errors.New("net url must be an absolute URL")
+		}
+	}
+
 	if cfg.Net.TLS.Cert != "" && cfg.Net.TLS.Key != "" {
 		cert, err := tls.LoadX509KeyPair(cfg.Net.TLS.Cert, cfg.Net.TLS.Key)
 
@@ -142,57 +466,106 @@ func DecodeConfig(f *os.File) (*Server, func(), error) {
 		}
 	}
 
-	log, err := logger(cfg.Log)
+	log, err := logger(cfg.Log, cfg.LogRotate)
 
 	if err != nil {
 		return nil, nil, err
 	}
 
-	log.Info.Println("using write_timeout of", cfg.Net.WriteTimeout)
-	log.Info.Println("using read_timeout of", cfg.Net.ReadTimeout)
+	log.Info.With("write_timeout", cfg.Net.WriteTimeout).Println("using write_timeout")
+	log.Info.With("read_timeout", cfg.Net.ReadTimeout).Println("using read_timeout")
 
-	sc := &Scanner{
-		dir: cfg.Store.Path,
-		errh: func(err error) {
-			log.Error.Println("failed to scan images", err)
-		},
-		drivers: make(map[string]driver),
+	sc, err := scanner(cfg, log)
+
+	if err != nil {
+		return nil, nil, err
 	}
 
-	for name, cfg := range cfg.Driver {
-		if _, ok := drivers[name]; !ok {
-			return nil, nil, errors.New("unknown driver: " + name)
-		}
+	th, err := theme(cfg)
 
-		categories := make(map[string]struct{})
+	if err != nil {
+		return nil, nil, err
+	}
 
-		for _, name := range cfg.Categories {
-			categories[name] = struct{}{}
-		}
+	db, err := InitDB(cfg.Store.Database)
 
-		groups := make([]driverGroup, 0, len(cfg.Groups))
+	if err != nil {
+		return nil, nil, err
+	}
 
-		for _, group := range cfg.Groups {
-			re, err := regexp.Compile(group.Pattern)
+	close := func() {
+		db.Close()
+		log.Close()
+		os.RemoveAll(pidfile)
+	}
 
-			if err != nil {
-				return nil, nil, err
-			}
+	feedMaxAge := cfg.Store.FeedMaxAge
 
-			groups = append(groups, driverGroup{
-				name: group.Name,
-				re:   re,
-			})
-		}
+	if feedMaxAge == 0 {
+		feedMaxAge = defaultFeedMaxAge
+	}
 
-		sc.drivers[name] = driver{
-			name:       name,
-			categories: categories,
-			groups:     groups,
-		}
+	return &Server{
+		Server:          srv,
+		DB:              db,
+		Log:             log,
+		Scanner:         sc,
+		ScanInterval:    cfg.Store.ScanInterval,
+		FeedMaxAge:      feedMaxAge,
+		DownloadsMaxAge: downloadsMaxAge,
+		URL:             strings.TrimSuffix(cfg.Net.URL, "/"),
+		Theme:           th,
+	}, close, nil
+}
+
+// downloadsMaxAge returns how long downloads are kept for. This cannot be less
+// than the unused period of the retention policy, otherwise an image could be
+// removed even though it was downloaded within that period.
+func downloadsMaxAge(cfg serverConfig) (time.Duration, error) {
+	maxAge := cfg.Store.DownloadsMaxAge
+
+	if maxAge == 0 {
+		maxAge = defaultDownloadsMaxAge
+	}
+
+	if cfg.Store.Retention.Unused > maxAge {
+		return 0, errors.New("store retention unused cannot be longer than downloads_max_age")
+	}
+	return maxAge, nil
+}
+
+// DecodeGCConfig decodes the config in the given file into a GC for removing
+// stale images from the store.
+func DecodeGCConfig(f *os.File) (*GC, func(), error) {
+	cfg, err := decodeConfig(f)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Without a database there are no download statistics, so every image
+	// would look as though it has never been downloaded.
+	if cfg.Store.Retention.Unused > 0 && cfg.Store.Database == "" {
+		return nil, nil, errors.New("store retention unused requires a store database")
+	}
+
+	if _, err := downloadsMaxAge(cfg); err != nil {
+		return nil, nil, err
 	}
 
-	db, err := InitDB()
+	log, err := logger(cfg.Log, cfg.LogRotate)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sc, err := scanner(cfg, log)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := InitDB(cfg.Store.Database)
 
 	if err != nil {
 		return nil, nil, err
@@ -200,14 +573,17 @@ func DecodeConfig(f *os.File) (*Server, func(), error) {
 
 	close := func() {
 		db.Close()
-		os.RemoveAll(pidfile)
+		log.Close()
 	}
 
-	return &Server{
-		Server:       srv,
-		DB:           db,
-		Log:          log,
-		Scanner:      sc,
-		ScanInterval: cfg.Store.ScanInterval,
+	return &GC{
+		DB:      db,
+		Log:     log,
+		Scanner: sc,
+		Policy: RetentionPolicy{
+			MaxAge: cfg.Store.Retention.MaxAge,
+			Unused: cfg.Store.Retention.Unused,
+			Keep:   int(cfg.Store.Retention.Keep),
+		},
 	}, close, nil
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLabels(t *testing.T) {
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "imgsrv.log")
+
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`log info "` + dst + `"`, ""},
+		{`log INFO "` + dst + `"`, ""},
+		{`log { debug "` + dst + `"; format "json" }`, ""},
+		{`log info "` + dst + `"
+log_rotate {
+	size 10MB
+	age  24h
+}`, ""},
+		{`log warning "` + dst + `"`, "unknown log level warning"},
+		{`log format "xml"`, "unknown log format xml"},
+	}
+
+	for i, test := range tests {
+		path := filepath.Join(dir, "imgsrv.conf")
+
+		if err := os.WriteFile(path, []byte(test.src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.Open(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cfg, err := decodeConfig(f)
+		f.Close()
+
+		if err != nil {
+			t.Fatalf("tests[%d]: %s", i, err)
+		}
+
+		if strings.Contains(test.src, "log_rotate") && (cfg.LogRotate.Size != 10<<20 || cfg.LogRotate.Age.Hours() != 24) {
+			t.Errorf("tests[%d]: expected rotation at 10MB or 24h, got %+v", i, cfg.LogRotate)
+		}
+
+		log, err := logger(cfg.Log, cfg.LogRotate)
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("tests[%d]: expected error %q, got %v", i, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("tests[%d]: %s", i, err)
+			continue
+		}
+		log.Close()
+	}
+}
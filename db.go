@@ -2,6 +2,9 @@ package main
 
 import (
 	_ "embed"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"crawshaw.io/sqlite"
@@ -13,14 +16,27 @@ import (
 //go:embed schema.sql
 var schema string
 
+// DB is the catalog of images that have been scanned. The images themselves
+// are held in a temporary table that is rebuilt each time the database is
+// opened, whereas the download statistics are persisted to the database file,
+// if one is given. The underlying connection is not safe for concurrent use,
+// so access to it is serialized.
 type DB struct {
 	*sqlite.Conn
+
+	mu *sync.Mutex
 }
 
-func InitDB() (DB, error) {
+// InitDB opens the database at the given path and initializes its schema. If
+// the path is empty then an in-memory database is used.
+func InitDB(path string) (DB, error) {
 	var db DB
 
-	conn, err := sqlite.OpenConn(":memory:", sqlite.SQLITE_OPEN_READWRITE)
+	if path == "" {
+		path = ":memory:"
+	}
+
+	conn, err := sqlite.OpenConn(path, sqlite.SQLITE_OPEN_READWRITE|sqlite.SQLITE_OPEN_CREATE)
 
 	if err != nil {
 		return db, err
@@ -32,24 +48,39 @@ func InitDB() (DB, error) {
 
 	return DB{
 		Conn: conn,
+		mu:   &sync.Mutex{},
 	}, nil
 }
 
 var (
 	insertImg = `
 INSERT INTO images
-(path, driver, category, group_name, name, link, mod_time)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+(path, driver, category, group_name, name, link, mod_time, size, target, group_rule, link_category)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 `
 
 	updateImg = `
 UPDATE images
-SET mod_time = $1, link = $2
-WHERE (path = $3)
+SET mod_time = $1, link = $2, size = $3, target = $4, link_category = $5
+WHERE (path = $6)
 `
 )
 
 func (db DB) Load(imgs []*Image) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if err := db.load(imgs); err != nil {
+		return err
+	}
+
+	if err := db.saveTags(imgs); err != nil {
+		return err
+	}
+	return db.saveMeta(imgs)
+}
+
+func (db DB) load(imgs []*Image) error {
 	for _, img := range imgs {
 		stmt, err := db.Prepare(insertImg)
 
@@ -64,6 +95,10 @@ func (db DB) Load(imgs []*Image) error {
 		stmt.BindText(5, img.Name)
 		stmt.BindText(6, img.Link)
 		stmt.BindInt64(7, img.ModTime.Unix())
+		stmt.BindInt64(8, img.Size)
+		stmt.BindText(9, img.targetPath)
+		stmt.BindText(10, img.GroupRule)
+		stmt.BindText(11, img.linkCategory)
 
 		if _, err := stmt.Step(); err != nil {
 			sqlerr, _ := err.(sqlite.Error)
@@ -77,7 +112,10 @@ func (db DB) Load(imgs []*Image) error {
 
 				stmt.BindInt64(1, img.ModTime.Unix())
 				stmt.BindText(2, img.Link)
-				stmt.BindText(3, img.Path)
+				stmt.BindInt64(3, img.Size)
+				stmt.BindText(4, img.targetPath)
+				stmt.BindText(5, img.linkCategory)
+				stmt.BindText(6, img.Path)
 
 				if _, err := stmt.Step(); err != nil {
 					return err
@@ -98,6 +136,9 @@ func (db DB) Load(imgs []*Image) error {
 }
 
 func (db DB) Sync(imgs []*Image) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	nop := func(_ *sqlite.Stmt) error { return nil }
 
 	paths := make([]interface{}, 0, len(imgs))
@@ -135,7 +176,15 @@ func (db DB) Sync(imgs []*Image) (int, error) {
 		new = append(new, img)
 	}
 
-	if err := db.Load(new); err != nil {
+	if err := db.load(new); err != nil {
+		return 0, err
+	}
+
+	if err := db.saveTags(imgs); err != nil {
+		return 0, err
+	}
+
+	if err := db.saveMeta(imgs); err != nil {
 		return 0, err
 	}
 	return len(new), nil
@@ -159,12 +208,88 @@ func WhereCategory(category string) query.Option {
 	}
 }
 
-func WhereGroup(group string) query.Option {
+// WhereGroup matches the images in any of the given groups.
+func WhereGroup(groups ...string) query.Option {
+	return func(q query.Query) query.Query {
+		vals := make([]interface{}, 0, len(groups))
+
+		for _, group := range groups {
+			if group != "" {
+				vals = append(vals, group)
+			}
+		}
+
+		if len(vals) == 0 {
+			return q
+		}
+		return query.Where("group_name", "IN", query.List(vals...))(q)
+	}
+}
+
+// likeExpr is the argument for a LIKE pattern that uses \ as its escape
+// character.
+type likeExpr string
+
+func (e likeExpr) Args() []interface{} { return []interface{}{string(e)} }
+func (e likeExpr) Build() string       { return "? ESCAPE '\\'" }
+
+var likeEscaper = strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+
+// WhereName matches the images whose name matches the given pattern. If the
+// pattern contains any glob characters then it is matched as a glob, otherwise
+// it is matched as a case-insensitive substring.
+func WhereName(pattern string) query.Option {
 	return func(q query.Query) query.Query {
-		if group == "" {
+		if pattern == "" {
 			return q
 		}
-		return query.Where("group_name", "=", query.Arg(group))(q)
+
+		if strings.ContainsAny(pattern, "*?[") {
+			return query.Where("name", "GLOB", query.Arg(pattern))(q)
+		}
+		return query.Where("name", "LIKE", likeExpr("%"+likeEscaper.Replace(pattern)+"%"))(q)
+	}
+}
+
+var globEscaper = strings.NewReplacer("[", "[[]", "*", "[*]", "?", "[?]")
+
+// WhereDir matches the images whose names are directly within the given
+// directory, for example debian/12 is within debian, but debian/12/uefi is
+// not.
+func WhereDir(dir string) query.Option {
+	return func(q query.Query) query.Query {
+		prefix := globEscaper.Replace(dir) + "/"
+
+		q = query.Where("name", "GLOB", query.Arg(prefix+"*"))(q)
+		return query.Where("name", "NOT GLOB", query.Arg(prefix+"*/*"))(q)
+	}
+}
+
+// WhereModified matches the images that were modified within the given times.
+// A zero time means the images are unbounded in that direction.
+func WhereModified(after, before time.Time) query.Option {
+	return func(q query.Query) query.Query {
+		if !after.IsZero() {
+			q = query.Where("mod_time", ">=", query.Arg(after.Unix()))(q)
+		}
+		if !before.IsZero() {
+			q = query.Where("mod_time", "<", query.Arg(before.Unix()))(q)
+		}
+		return q
+	}
+}
+
+// WhereSize matches the images whose size is within the given bounds. A
+// bound of zero means the images are unbounded in that direction.
+func WhereSize(min, max int64) query.Option {
+	return func(q query.Query) query.Query {
+		if min > 0 {
+			q = query.Where("size", ">=", query.Arg(min))(q)
+		}
+		if max > 0 {
+			q = query.Where("size", "<=", query.Arg(max))(q)
+		}
+		return q
 	}
 }
 
@@ -176,6 +301,10 @@ var imageCols = []string{
 	"name",
 	"link",
 	"mod_time",
+	"size",
+	"target",
+	"group_rule",
+	"link_category",
 }
 
 func scanImage(img *Image) func(*sqlite.Stmt) error {
@@ -189,11 +318,29 @@ func scanImage(img *Image) func(*sqlite.Stmt) error {
 		img.Name = stmt.ColumnText(4)
 		img.Link = stmt.ColumnText(5)
 		img.ModTime = time.Unix(modtime, 0)
+		img.Size = stmt.ColumnInt64(7)
+		img.targetPath = stmt.ColumnText(8)
+		img.GroupRule = stmt.ColumnText(9)
+		img.linkCategory = stmt.ColumnText(10)
+
+		// A link to a file outside of the driver is named by the file's path,
+		// and has no image to point to.
+		if img.Link != "" && !filepath.IsAbs(img.Link) {
+			img.Target = (&Image{
+				Driver:   img.Driver,
+				Category: img.linkCategory,
+				Name:     img.Link,
+			}).Endpoint()
+		}
+		img.Manifest = newManifest(img)
 		return nil
 	}
 }
 
 func (db DB) Image(driver, category, name string) (*Image, bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	q := query.Select(
 		query.Columns(imageCols...),
 		query.From("images"),
@@ -210,10 +357,72 @@ func (db DB) Image(driver, category, name string) (*Image, bool, error) {
 		}
 		return nil, false, err
 	}
-	return &img, img.Path != "", nil
+
+	if img.Path == "" {
+		return nil, false, nil
+	}
+
+	set := map[string]*Image{
+		img.Path: &img,
+	}
+
+	if err := db.loadDownloads(set, []interface{}{img.Path}); err != nil {
+		return nil, false, err
+	}
+
+	if err := db.loadTags(set, []interface{}{img.Path}); err != nil {
+		return nil, false, err
+	}
+
+	if err := db.loadMeta(set, []interface{}{img.Path}); err != nil {
+		return nil, false, err
+	}
+	return &img, true, nil
+}
+
+// ImageCount is the number of images in a group of a category of a driver.
+type ImageCount struct {
+	Driver   string
+	Category string
+	Group    string
+	Images   int
+}
+
+// ImageCounts returns the number of images in each group of each category of
+// each driver, ordered by driver, category, then group.
+func (db DB) ImageCounts() ([]ImageCount, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	counts := make([]ImageCount, 0)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		counts = append(counts, ImageCount{
+			Driver:   stmt.ColumnText(0),
+			Category: stmt.ColumnText(1),
+			Group:    stmt.ColumnText(2),
+			Images:   stmt.ColumnInt(3),
+		})
+		return nil
+	}
+
+	q := `
+SELECT driver, category, group_name, COUNT(*)
+FROM images
+GROUP BY driver, category, group_name
+ORDER BY driver, category, group_name
+`
+
+	if err := sqlitex.Exec(db.Conn, q, scan); err != nil {
+		return nil, err
+	}
+	return counts, nil
 }
 
 func (db DB) Images(opts ...query.Option) ([]*Image, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	opts = append([]query.Option{
 		query.From("images"),
 	}, opts...)
@@ -243,5 +452,68 @@ func (db DB) Images(opts ...query.Option) ([]*Image, error) {
 	if err := sqlitex.Exec(db.Conn, q.Build(), scan, q.Args()...); err != nil {
 		return nil, err
 	}
+
+	if err := db.loadDownloads(set, paths); err != nil {
+		return nil, err
+	}
+
+	if err := db.loadTags(set, paths); err != nil {
+		return nil, err
+	}
+
+	if err := db.loadMeta(set, paths); err != nil {
+		return nil, err
+	}
 	return imgs, nil
 }
+
+// LinkTarget returns the image that is the target of a symbolic link with the
+// given name. Such images are not scanned into the catalog themselves, so this
+// is derived from the link that points to it.
+func (db DB) LinkTarget(driver, category, name string) (*Image, bool, error) {
+	imgs, err := db.Images(
+		query.Where("driver", "=", query.Arg(driver)),
+		query.Where("link_category", "=", query.Arg(category)),
+		query.Where("link", "=", query.Arg(name)),
+		query.Limit(1),
+	)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(imgs) == 0 || imgs[0].targetPath == "" {
+		return nil, false, nil
+	}
+
+	link := imgs[0]
+
+	img := &Image{
+		Path:      link.targetPath,
+		Driver:    link.Driver,
+		Category:  link.linkCategory,
+		Group:     link.Group,
+		GroupRule: link.GroupRule,
+		Name:      link.Link,
+		ModTime:   link.ModTime,
+		Size:      link.Size,
+		Tags:      link.Tags,
+		Meta:      link.Meta,
+	}
+
+	img.Manifest = newManifest(img)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// The tags and metadata of the target are only stored against the link,
+	// but downloads of the target are recorded against its own path.
+	set := map[string]*Image{
+		img.Path: img,
+	}
+
+	if err := db.loadDownloads(set, []interface{}{img.Path}); err != nil {
+		return nil, false, err
+	}
+	return img, true, nil
+}
@@ -0,0 +1,283 @@
+// Code generated by qtc from "detail.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line detail.qtpl:1
+package main
+
+//line detail.qtpl:3
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line detail.qtpl:3
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+// Detail is the page describing a single image, served in place of the image
+// when requested with the info query parameter.
+//
+//line detail.qtpl:4
+type Detail struct {
+	Image    *Image
+	Checksum string
+
+	// History is the other images in the same directory as the image, newest
+	// first.
+	History []*Image
+
+	Theme       *Theme
+	DjinnServer string
+}
+
+//line detail.qtpl:20
+func (p *Detail) StreamRender(qw422016 *qt422016.Writer) {
+//line detail.qtpl:20
+	qw422016.N().S(` <!DOCTYPE HTML> <html lang="en"> <head> `)
+//line detail.qtpl:24
+	streamrenderHead(qw422016, p.Theme, p.Image.Name)
+//line detail.qtpl:24
+	qw422016.N().S(` </head> <body> <div class="content"> `)
+//line detail.qtpl:28
+	streamrenderTitle(qw422016, p.Theme, p.DjinnServer)
+//line detail.qtpl:28
+	qw422016.N().S(` <div class="panel detail"> <div class="panel-header"> <h3>`)
+//line detail.qtpl:31
+	qw422016.E().S(p.Image.Driver)
+//line detail.qtpl:31
+	qw422016.N().S(` / `)
+//line detail.qtpl:31
+	if p.Image.Category != "" {
+//line detail.qtpl:31
+		qw422016.E().S(p.Image.Category)
+//line detail.qtpl:31
+		qw422016.N().S(` / `)
+//line detail.qtpl:31
+	}
+//line detail.qtpl:31
+	qw422016.E().S(p.Image.Name)
+//line detail.qtpl:31
+	qw422016.N().S(`</h3> <a class="pill download" href="`)
+//line detail.qtpl:32
+	qw422016.E().S(p.Image.Endpoint())
+//line detail.qtpl:32
+	qw422016.N().S(`" download>Download</a> </div> <div class="panel-body"> `)
+//line detail.qtpl:35
+	streamrenderMeta(qw422016, p.Image.Meta)
+//line detail.qtpl:35
+	qw422016.N().S(` `)
+//line detail.qtpl:36
+	if len(p.Image.Tags) > 0 {
+//line detail.qtpl:36
+		qw422016.N().S(` <div class="tags"> `)
+//line detail.qtpl:38
+		for _, tag := range p.Image.Tags {
+//line detail.qtpl:38
+			qw422016.N().S(` <a class="chip" href="/`)
+//line detail.qtpl:39
+			qw422016.E().S(p.Image.Driver)
+//line detail.qtpl:39
+			qw422016.N().S(`?tag=`)
+//line detail.qtpl:39
+			qw422016.N().U(tag)
+//line detail.qtpl:39
+			qw422016.N().S(`" title="Images with this tag">`)
+//line detail.qtpl:39
+			qw422016.E().S(tag)
+//line detail.qtpl:39
+			qw422016.N().S(`</a> `)
+//line detail.qtpl:40
+		}
+//line detail.qtpl:40
+		qw422016.N().S(` </div> `)
+//line detail.qtpl:42
+	}
+//line detail.qtpl:42
+	qw422016.N().S(` <table class="detail-table"> `)
+//line detail.qtpl:44
+	if p.Image.Alias != "" {
+//line detail.qtpl:44
+		qw422016.N().S(` <tr><th>Alias</th><td>`)
+//line detail.qtpl:45
+		qw422016.E().S(p.Image.Alias)
+//line detail.qtpl:45
+		qw422016.N().S(`</td></tr> `)
+//line detail.qtpl:46
+	}
+//line detail.qtpl:46
+	qw422016.N().S(` `)
+//line detail.qtpl:47
+	if p.Image.Link != "" {
+//line detail.qtpl:47
+		qw422016.N().S(` <tr><th>Link target</th><td><a href="`)
+//line detail.qtpl:48
+		qw422016.E().S(p.Image.Target)
+//line detail.qtpl:48
+		qw422016.N().S(`?info">`)
+//line detail.qtpl:48
+		qw422016.E().S(p.Image.Link)
+//line detail.qtpl:48
+		qw422016.N().S(`</a></td></tr> `)
+//line detail.qtpl:49
+	}
+//line detail.qtpl:49
+	qw422016.N().S(` `)
+//line detail.qtpl:50
+	if p.Image.Group != "" {
+//line detail.qtpl:50
+		qw422016.N().S(` <tr><th>Group</th><td>`)
+//line detail.qtpl:51
+		qw422016.E().S(p.Image.Group)
+//line detail.qtpl:51
+		qw422016.N().S(`</td></tr> `)
+//line detail.qtpl:52
+	}
+//line detail.qtpl:52
+	qw422016.N().S(` <tr><th>Size</th><td title="`)
+//line detail.qtpl:53
+	qw422016.N().DL(p.Image.Size)
+//line detail.qtpl:53
+	qw422016.N().S(` bytes">`)
+//line detail.qtpl:53
+	qw422016.E().S(formatSize(p.Image.Size))
+//line detail.qtpl:53
+	qw422016.N().S(`</td></tr> <tr><th>Modified</th><td>`)
+//line detail.qtpl:54
+	qw422016.E().S(p.Image.ModTime.Format("Mon, 02 Jan 2006 15:04:05 MST"))
+//line detail.qtpl:54
+	qw422016.N().S(`</td></tr> <tr> <th>SHA256</th> `)
+//line detail.qtpl:57
+	if p.Checksum != "" {
+//line detail.qtpl:57
+		qw422016.N().S(` <td><code>`)
+//line detail.qtpl:58
+		qw422016.E().S(p.Checksum)
+//line detail.qtpl:58
+		qw422016.N().S(`</code></td> `)
+//line detail.qtpl:59
+	} else {
+//line detail.qtpl:59
+		qw422016.N().S(` <td class="muted">unknown</td> `)
+//line detail.qtpl:61
+	}
+//line detail.qtpl:61
+	qw422016.N().S(` </tr> <tr> <th>Downloads</th> <td> `)
+//line detail.qtpl:66
+	qw422016.N().DL(p.Image.Downloads)
+//line detail.qtpl:66
+	qw422016.N().S(` `)
+//line detail.qtpl:67
+	if p.Image.LastDownload != nil {
+//line detail.qtpl:67
+		qw422016.N().S(` <span class="muted">, last pulled `)
+//line detail.qtpl:68
+		qw422016.E().S(p.Image.LastDownload.Format("Mon, 02 Jan 2006"))
+//line detail.qtpl:68
+		qw422016.N().S(`</span> `)
+//line detail.qtpl:69
+	}
+//line detail.qtpl:69
+	qw422016.N().S(` </td> </tr> </table> <h4>Manifest</h4> <pre class="manifest"><code>`)
+//line detail.qtpl:74
+	qw422016.E().S(p.Image.Manifest.String())
+//line detail.qtpl:74
+	qw422016.N().S(`</code></pre> <button class="copy" data-copy="`)
+//line detail.qtpl:75
+	qw422016.E().S(p.Image.Manifest.String())
+//line detail.qtpl:75
+	qw422016.N().S(`">Copy</button> </div> </div> `)
+//line detail.qtpl:78
+	if len(p.History) > 0 {
+//line detail.qtpl:78
+		qw422016.N().S(` <div class="panel"> <div class="panel-header"><h3>History</h3></div> `)
+//line detail.qtpl:81
+		for _, img := range p.History {
+//line detail.qtpl:81
+			qw422016.N().S(` <div class="panel-row"> <div class="left"> `)
+//line detail.qtpl:84
+			if img.Path == p.Image.Path {
+//line detail.qtpl:84
+				qw422016.N().S(` <strong>`)
+//line detail.qtpl:85
+				qw422016.E().S(img.Name)
+//line detail.qtpl:85
+				qw422016.N().S(`</strong> `)
+//line detail.qtpl:86
+			} else {
+//line detail.qtpl:86
+				qw422016.N().S(` <a href="`)
+//line detail.qtpl:87
+				qw422016.E().S(img.Endpoint())
+//line detail.qtpl:87
+				qw422016.N().S(`?info">`)
+//line detail.qtpl:87
+				qw422016.E().S(img.Name)
+//line detail.qtpl:87
+				qw422016.N().S(`</a> `)
+//line detail.qtpl:88
+			}
+//line detail.qtpl:88
+			qw422016.N().S(` `)
+//line detail.qtpl:89
+			if img.Link != "" {
+//line detail.qtpl:89
+				qw422016.N().S(` <span class="muted">&rarr; `)
+//line detail.qtpl:90
+				qw422016.E().S(img.Link)
+//line detail.qtpl:90
+				qw422016.N().S(`</span> `)
+//line detail.qtpl:91
+			}
+//line detail.qtpl:91
+			qw422016.N().S(` </div> <div class="right muted"> `)
+//line detail.qtpl:94
+			qw422016.E().S(formatSize(img.Size))
+//line detail.qtpl:94
+			qw422016.N().S(`, `)
+//line detail.qtpl:94
+			qw422016.E().S(img.ModTime.Format("Mon, 02 Jan 2006"))
+//line detail.qtpl:94
+			qw422016.N().S(` </div> </div> `)
+//line detail.qtpl:97
+		}
+//line detail.qtpl:97
+		qw422016.N().S(` </div> `)
+//line detail.qtpl:99
+	}
+//line detail.qtpl:99
+	qw422016.N().S(` `)
+//line detail.qtpl:100
+	streamrenderLinks(qw422016, p.Theme)
+//line detail.qtpl:100
+	qw422016.N().S(` </div> </body> <footer> <script type="text/javascript"> var btns = document.querySelectorAll("[data-copy]"); for (var i = 0; i < btns.length; i++) { btns[i].addEventListener("click", function(e) { e.preventDefault(); var btn = e.target; var text = btn.innerText; navigator.clipboard.writeText(btn.dataset.copy).then(function() { btn.innerText = "Copied"; setTimeout(function() { btn.innerText = text; }, 2000); }); }); } </script> </footer> </html> `)
+//line detail.qtpl:126
+}
+
+//line detail.qtpl:126
+func (p *Detail) WriteRender(qq422016 qtio422016.Writer) {
+//line detail.qtpl:126
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line detail.qtpl:126
+	p.StreamRender(qw422016)
+//line detail.qtpl:126
+	qt422016.ReleaseWriter(qw422016)
+//line detail.qtpl:126
+}
+
+//line detail.qtpl:126
+func (p *Detail) Render() string {
+//line detail.qtpl:126
+	qb422016 := qt422016.AcquireByteBuffer()
+//line detail.qtpl:126
+	p.WriteRender(qb422016)
+//line detail.qtpl:126
+	qs422016 := string(qb422016.B)
+//line detail.qtpl:126
+	qt422016.ReleaseByteBuffer(qb422016)
+//line detail.qtpl:126
+	return qs422016
+//line detail.qtpl:126
+}
@@ -0,0 +1,100 @@
+// Code generated by qtc from "error.qtpl". DO NOT EDIT.
+// See https://github.com/valyala/quicktemplate for details.
+
+//line error.qtpl:1
+package main
+
+//line error.qtpl:3
+import "strconv"
+
+//line error.qtpl:5
+import (
+	qtio422016 "io"
+
+	qt422016 "github.com/valyala/quicktemplate"
+)
+
+//line error.qtpl:5
+var (
+	_ = qtio422016.Copy
+	_ = qt422016.AcquireByteBuffer
+)
+
+// ErrorPage is the page served to browsers when a request fails.
+//
+//line error.qtpl:6
+type ErrorPage struct {
+	Problem Problem
+
+	Theme       *Theme
+	DjinnServer string
+}
+
+//line error.qtpl:16
+func (p *ErrorPage) StreamRender(qw422016 *qt422016.Writer) {
+//line error.qtpl:16
+	qw422016.N().S(` <!DOCTYPE HTML> <html lang="en"> <head> `)
+//line error.qtpl:20
+	streamrenderHead(qw422016, p.Theme, strconv.Itoa(p.Problem.Status)+" "+p.Problem.Title)
+//line error.qtpl:20
+	qw422016.N().S(` </head> <body> <div class="content"> `)
+//line error.qtpl:24
+	streamrenderTitle(qw422016, p.Theme, p.DjinnServer)
+//line error.qtpl:24
+	qw422016.N().S(` <div class="panel error"> <div class="panel-header"> <h3>`)
+//line error.qtpl:27
+	qw422016.N().D(p.Problem.Status)
+//line error.qtpl:27
+	qw422016.N().S(` `)
+//line error.qtpl:27
+	qw422016.E().S(p.Problem.Title)
+//line error.qtpl:27
+	qw422016.N().S(`</h3> </div> <div class="panel-body"> `)
+//line error.qtpl:30
+	if p.Problem.Detail != "" {
+//line error.qtpl:30
+		qw422016.N().S(` <p>`)
+//line error.qtpl:31
+		qw422016.E().S(p.Problem.Detail)
+//line error.qtpl:31
+		qw422016.N().S(`</p> `)
+//line error.qtpl:32
+	} else if p.Problem.Status == 500 {
+//line error.qtpl:32
+		qw422016.N().S(` <p>Something went wrong on our end, please try again later.</p> `)
+//line error.qtpl:34
+	}
+//line error.qtpl:34
+	qw422016.N().S(` <p><a href="/">Back to all images</a></p> </div> </div> `)
+//line error.qtpl:38
+	streamrenderLinks(qw422016, p.Theme)
+//line error.qtpl:38
+	qw422016.N().S(` </div> </body> </html> `)
+//line error.qtpl:42
+}
+
+//line error.qtpl:42
+func (p *ErrorPage) WriteRender(qq422016 qtio422016.Writer) {
+//line error.qtpl:42
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line error.qtpl:42
+	p.StreamRender(qw422016)
+//line error.qtpl:42
+	qt422016.ReleaseWriter(qw422016)
+//line error.qtpl:42
+}
+
+//line error.qtpl:42
+func (p *ErrorPage) Render() string {
+//line error.qtpl:42
+	qb422016 := qt422016.AcquireByteBuffer()
+//line error.qtpl:42
+	p.WriteRender(qb422016)
+//line error.qtpl:42
+	qs422016 := string(qb422016.B)
+//line error.qtpl:42
+	qt422016.ReleaseByteBuffer(qb422016)
+//line error.qtpl:42
+	return qs422016
+//line error.qtpl:42
+}
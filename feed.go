@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+
+	"github.com/andrewpillar/query"
+)
+
+const (
+	// EventAdded is the kind of event recorded when an image first appears in the
+	// store.
+	EventAdded = "added"
+
+	// EventUpdated is the kind of event recorded when the modification time of an
+	// image changes.
+	EventUpdated = "updated"
+)
+
+// defaultFeedMaxAge is how long events are kept for if no maximum age is
+// configured.
+const defaultFeedMaxAge = 30 * 24 * time.Hour
+
+// Event is a change to an image in the store that was seen during a sync. The
+// image of an event is how the image was at the time of the event.
+type Event struct {
+	Kind  string
+	Image *Image
+	Time  time.Time
+}
+
+var (
+	insertEvent = `
+INSERT INTO events
+(path, driver, category, group_name, name, kind, mod_time, size, recorded_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+`
+
+	upsertSeen = `
+INSERT INTO seen_images (path, mod_time) VALUES ($1, $2)
+ON CONFLICT (path) DO UPDATE SET mod_time = excluded.mod_time
+`
+)
+
+// RecordEvents records an event for each of the given images that changed
+// since the images were last seen. This should be called with the images
+// loaded when the server starts, so the images that changed whilst the server
+// was down are recorded too.
+func (db DB) RecordEvents(imgs []*Image) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.recordEvents(imgs, time.Now())
+}
+
+// recordEvents records an event for each of the given images that changed
+// since the images were last seen. The images seen, and their modification
+// times, are kept alongside the events, so any image not seen before is
+// recorded as added. If no images have been seen before, such as with a new
+// database, then the images are only taken as seen, so the whole store is not
+// recorded as added. The given images should be every image in the store, as
+// the images seen are replaced with them.
+func (db DB) recordEvents(imgs []*Image, t time.Time) error {
+	nop := func(_ *sqlite.Stmt) error { return nil }
+
+	seen := make(map[string]int64)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		seen[stmt.ColumnText(0)] = stmt.ColumnInt64(1)
+		return nil
+	}
+
+	if err := sqlitex.Exec(db.Conn, "SELECT path, mod_time FROM seen_images", scan); err != nil {
+		return err
+	}
+
+	first := len(seen) == 0
+
+	paths := make([]interface{}, 0, len(imgs))
+
+	for _, img := range imgs {
+		paths = append(paths, img.Path)
+
+		kind := EventAdded
+
+		if mod, ok := seen[img.Path]; ok {
+			if mod == img.ModTime.Unix() {
+				continue
+			}
+			kind = EventUpdated
+		}
+
+		if !first {
+			err := sqlitex.Exec(
+				db.Conn,
+				insertEvent,
+				nop,
+				img.Path,
+				img.Driver,
+				img.Category,
+				img.Group,
+				img.Name,
+				kind,
+				img.ModTime.Unix(),
+				img.Size,
+				t.Unix(),
+			)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := sqlitex.Exec(db.Conn, upsertSeen, nop, img.Path, img.ModTime.Unix()); err != nil {
+			return err
+		}
+	}
+
+	// Forget the images that are gone, so they are recorded as added should
+	// they come back.
+	q := query.Delete("seen_images", query.Where("path", "NOT IN", query.List(paths...)))
+
+	return sqlitex.Exec(db.Conn, q.Build(), nop, q.Args()...)
+}
+
+// PruneEvents removes the events recorded before the given time.
+func (db DB) PruneEvents(before time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	nop := func(_ *sqlite.Stmt) error { return nil }
+
+	q := query.Delete("events", query.Where("recorded_at", "<", query.Arg(before.Unix())))
+
+	return sqlitex.Exec(db.Conn, q.Build(), nop, q.Args()...)
+}
+
+// Events returns at most limit events that match the given query options,
+// most recent first.
+func (db DB) Events(limit int64, opts ...query.Option) ([]*Event, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	opts = append([]query.Option{
+		query.From("events"),
+	}, opts...)
+
+	opts = append(opts,
+		query.OrderDesc("recorded_at DESC", "mod_time DESC", "path"),
+		query.Limit(limit),
+	)
+
+	q := query.Select(
+		query.Columns("path", "driver", "category", "group_name", "name", "kind", "mod_time", "size", "recorded_at"),
+		opts...,
+	)
+
+	evs := make([]*Event, 0)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		evs = append(evs, &Event{
+			Kind: stmt.ColumnText(5),
+			Image: &Image{
+				Path:     stmt.ColumnText(0),
+				Driver:   stmt.ColumnText(1),
+				Category: stmt.ColumnText(2),
+				Group:    stmt.ColumnText(3),
+				Name:     stmt.ColumnText(4),
+				ModTime:  time.Unix(stmt.ColumnInt64(6), 0),
+				Size:     stmt.ColumnInt64(7),
+			},
+			Time: time.Unix(stmt.ColumnInt64(8), 0),
+		})
+		return nil
+	}
+
+	if err := sqlitex.Exec(db.Conn, q.Build(), scan, q.Args()...); err != nil {
+		return nil, err
+	}
+	return evs, nil
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Summary    string         `xml:"summary"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// baseURL returns the scheme and host of the server. This is the configured
+// URL of the server, otherwise the Host the given request was made to. The
+// X-Forwarded-Proto header is not trusted, as it can be set by any client, so
+// a server behind a proxy that terminates TLS should have its URL configured.
+func (s *Server) baseURL(r *http.Request) string {
+	if s.URL != "" {
+		return s.URL
+	}
+
+	scheme := "http"
+
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// Feed serves an Atom feed of the images that were recently added to, or
+// updated in the store. The feed can be narrowed down via the driver,
+// category, and group query parameters, and the number of entries is set via
+// the limit query parameter, which is 50 by default.
+func (s *Server) Feed(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := int64(50)
+
+	if val := q.Get("limit"); val != "" {
+		i, err := strconv.ParseInt(val, 10, 64)
+
+		if err != nil || i < 1 || i > 500 {
+			s.Error(w, r, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = i
+	}
+
+	evs, err := s.DB.Events(
+		limit,
+		WhereDriver(q.Get("driver")),
+		WhereCategory(q.Get("category")),
+		WhereGroup(q["group"]...),
+	)
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	base := s.baseURL(r)
+	host := r.Host
+
+	if u, err := url.Parse(base); err == nil {
+		host = u.Hostname()
+	}
+
+	self := base + r.URL.RequestURI()
+
+	feed := atomFeed{
+		ID:    self,
+		Title: s.Theme.title(),
+		Author: atomAuthor{
+			Name: s.Theme.title(),
+		},
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: base + "/", Rel: "alternate", Type: "text/html"},
+		},
+		Entries: make([]atomEntry, 0, len(evs)),
+	}
+
+	// The feed was last updated when the most recent event was recorded.
+	feed.Updated = time.Now().UTC().Format(time.RFC3339)
+
+	if len(evs) > 0 {
+		feed.Updated = evs[0].Time.UTC().Format(time.RFC3339)
+	}
+
+	for _, ev := range evs {
+		img := ev.Image
+		endpoint := img.Endpoint()
+
+		title := "Added "
+
+		if ev.Kind == EventUpdated {
+			title = "Updated "
+		}
+
+		cats := []atomCategory{
+			{Term: img.Driver},
+		}
+
+		if img.Category != "" {
+			cats = append(cats, atomCategory{Term: img.Category})
+		}
+
+		if img.Group != "" {
+			cats = append(cats, atomCategory{Term: img.Group})
+		}
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:         "tag:" + host + "," + ev.Time.UTC().Format("2006-01-02") + ":" + endpoint + "@" + strconv.FormatInt(img.ModTime.Unix(), 10),
+			Title:      title + strings.TrimPrefix(endpoint, "/"),
+			Updated:    ev.Time.UTC().Format(time.RFC3339),
+			Link:       atomLink{Href: base + endpoint + "?info"},
+			Summary:    formatSize(img.Size) + ", modified " + img.ModTime.UTC().Format(time.RFC1123),
+			Categories: cats,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	io.WriteString(w, xml.Header)
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+
+	if err := enc.Encode(feed); err != nil {
+		s.Log.Error.With("err", err).Println("failed to encode feed")
+	}
+}
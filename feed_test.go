@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordEventsAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "imgsrv.db")
+	modTime := time.Now().Add(-time.Hour)
+
+	debian := &Image{Path: "/store/qemu/debian/12", Driver: "qemu", Name: "debian/12", ModTime: modTime}
+	alpine := &Image{Path: "/store/qemu/alpine/3.17", Driver: "qemu", Name: "alpine/3.17", ModTime: modTime}
+
+	db, err := InitDB(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.RecordEvents([]*Image{debian}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The images first recorded are only taken as seen.
+	if evs, err := db.Events(10); err != nil || len(evs) != 0 {
+		t.Errorf("expected no events for the first images, got %d (err=%v)", len(evs), err)
+	}
+	db.Close()
+
+	// Whilst the server is down, an image is added, and another updated.
+	debian.ModTime = modTime.Add(time.Minute)
+
+	db, err = InitDB(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	imgs := []*Image{debian, alpine}
+
+	if err := db.Load(imgs); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.RecordEvents(imgs); err != nil {
+		t.Fatal(err)
+	}
+
+	evs, err := db.Events(10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kinds := make(map[string][]string)
+
+	for _, ev := range evs {
+		kinds[ev.Image.Name] = append(kinds[ev.Image.Name], ev.Kind)
+	}
+
+	if got := kinds["alpine/3.17"]; len(got) != 1 || got[0] != EventAdded {
+		t.Errorf("alpine/3.17: expected events [%s], got %v", EventAdded, got)
+	}
+
+	if got := kinds["debian/12"]; len(got) != 1 || got[0] != EventUpdated {
+		t.Errorf("debian/12: expected events [%s], got %v", EventUpdated, got)
+	}
+
+	// Nothing changed, so nothing more is recorded.
+	if err := db.RecordEvents(imgs); err != nil {
+		t.Fatal(err)
+	}
+
+	if evs2, err := db.Events(10); err != nil || len(evs2) != len(evs) {
+		t.Errorf("expected %d events, got %d (err=%v)", len(evs), len(evs2), err)
+	}
+
+	if err := db.PruneEvents(time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	if evs, err = db.Events(10); err != nil || len(evs) != 0 {
+		t.Errorf("expected no events after pruning, got %d (err=%v)", len(evs), err)
+	}
+}
+
+func TestFeedBaseURL(t *testing.T) {
+	s := testServer(t)
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"", `href="http://images.example.com/"`},
+		{"https://images.djinn-ci.com", `href="https://images.djinn-ci.com/"`},
+	}
+
+	for _, test := range tests {
+		s.URL = test.url
+
+		req := httptest.NewRequest("GET", "/feed", nil)
+		req.Host = "images.example.com"
+		req.Header.Set("X-Forwarded-Proto", "gopher")
+
+		rec := httptest.NewRecorder()
+		s.Feed(rec, req)
+
+		if rec.Code != 200 {
+			t.Errorf("%q: expected status 200, got %d", test.url, rec.Code)
+			continue
+		}
+
+		if body := rec.Body.String(); !strings.Contains(body, test.expected) {
+			t.Errorf("%q: expected %s in feed, got %s", test.url, test.expected, body)
+		}
+	}
+}
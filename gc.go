@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy determines which images in the store are stale, and can be
+// removed. An image is stale if it was last modified before the maximum age,
+// and has not been downloaded within the unused period. An image that is the
+// target of a symbolic link is never stale, neither are the newest images in
+// each directory, up to the number of images to keep.
+type RetentionPolicy struct {
+	MaxAge time.Duration
+	Unused time.Duration
+	Keep   int
+}
+
+// staleImage is an image that matched the retention policy, along with the
+// reason it matched.
+type staleImage struct {
+	*Image
+
+	reason string
+}
+
+func (p RetentionPolicy) empty() bool { return p.MaxAge == 0 && p.Unused == 0 }
+
+// Stale returns the images that match the retention policy. The given paths
+// are of the images that must be kept regardless, such as the targets of
+// symbolic links and aliases.
+func (p RetentionPolicy) Stale(imgs []*Image, keep map[string]struct{}, now time.Time) []staleImage {
+	dirs := make(map[string][]*Image)
+	order := make([]string, 0)
+
+	for _, img := range imgs {
+		// Links are cheap to keep, and removing them would break the names
+		// people rely on, so they are left alone.
+		if img.Link != "" {
+			continue
+		}
+
+		if _, ok := keep[img.Path]; ok {
+			continue
+		}
+
+		dir := filepath.Dir(img.Path)
+
+		if _, ok := dirs[dir]; !ok {
+			order = append(order, dir)
+		}
+		dirs[dir] = append(dirs[dir], img)
+	}
+
+	stale := make([]staleImage, 0)
+
+	for _, dir := range order {
+		imgs := dirs[dir]
+
+		sort.SliceStable(imgs, func(i, j int) bool {
+			return imgs[i].ModTime.After(imgs[j].ModTime)
+		})
+
+		for i, img := range imgs {
+			if i < p.Keep {
+				continue
+			}
+
+			var reason string
+
+			if p.MaxAge > 0 {
+				if age := now.Sub(img.ModTime); age > p.MaxAge {
+					reason = "modified " + age.Truncate(time.Hour).String() + " ago"
+				} else {
+					continue
+				}
+			}
+
+			if p.Unused > 0 {
+				if img.LastDownload != nil && now.Sub(*img.LastDownload) <= p.Unused {
+					continue
+				}
+
+				if reason != "" {
+					reason += ", "
+				}
+
+				if img.LastDownload == nil {
+					reason += "never downloaded"
+				} else {
+					reason += "last downloaded " + now.Sub(*img.LastDownload).Truncate(time.Hour).String() + " ago"
+				}
+			}
+			stale = append(stale, staleImage{
+				Image:  img,
+				reason: reason,
+			})
+		}
+	}
+	return stale
+}
+
+// GC removes the stale images from the store, as determined by the retention
+// policy.
+type GC struct {
+	DB      DB
+	Log     *Logger
+	Scanner *Scanner
+	Policy  RetentionPolicy
+}
+
+// Run scans the store for stale images and removes them, writing the path of
+// each image removed to the given io.Writer. If dryrun is true then the stale
+// images are only written, and not removed.
+func (gc *GC) Run(w io.Writer, dryrun bool) error {
+	if gc.Policy.empty() {
+		return errors.New("no retention policy configured")
+	}
+
+	// Never remove anything if part of the store could not be scanned, as the
+	// images that could not be scanned might be the target of a link.
+	imgs, targets, err := gc.Scanner.scan()
+
+	if err != nil {
+		return err
+	}
+
+	if err := gc.DB.LoadDownloads(imgs); err != nil {
+		return err
+	}
+
+	aliased, err := gc.aliased(imgs)
+
+	if err != nil {
+		return err
+	}
+
+	for path := range aliased {
+		targets[path] = struct{}{}
+	}
+
+	stale := gc.Policy.Stale(imgs, targets, time.Now())
+
+	for _, img := range stale {
+		if dryrun {
+			fmt.Fprintf(w, "%s (%s)\n", img.Path, img.reason)
+			continue
+		}
+
+		if err := os.Remove(img.Path); err != nil {
+			gc.Log.Error.With("path", img.Path, "err", err).Println("failed to remove image")
+			continue
+		}
+
+		for _, ext := range sidecarExts {
+			if err := os.Remove(img.Path + ext); err != nil && !errors.Is(err, os.ErrNotExist) {
+				gc.Log.Warn.With("path", img.Path+ext, "err", err).Println("failed to remove sidecar")
+			}
+		}
+
+		gc.Log.Info.With("path", img.Path, "driver", img.Driver, "reason", img.reason).Println("removed image")
+		fmt.Fprintf(w, "%s (%s)\n", img.Path, img.reason)
+	}
+	return nil
+}
+
+// aliased returns the paths of the images the aliases of each driver resolve
+// to, in each category of the given images.
+func (gc *GC) aliased(imgs []*Image) (map[string]struct{}, error) {
+	if err := gc.DB.Load(imgs); err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]struct{})
+	seen := make(map[string]struct{})
+
+	for _, img := range imgs {
+		key := img.Driver + "/" + img.Category
+
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		d, ok := gc.Scanner.drivers[img.Driver]
+
+		if !ok {
+			continue
+		}
+
+		for _, a := range d.aliases {
+			target, ok, err := gc.DB.ResolveAlias(img.Driver, img.Category, a)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				paths[target.Path] = struct{}{}
+			}
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGCKeepsAliasTargets(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// Each image is a month older than the one before it.
+	imgs := []string{
+		"alpine/edge",
+		"alpine/3.17",
+		"alpine/3.16",
+		"debian/12",
+		"debian/11",
+		"debian/10",
+	}
+
+	for i, name := range imgs {
+		path := filepath.Join(dir, "qemu", "x86_64", name)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		modTime := now.AddDate(0, -(i%3)-1, 0)
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	log := NewLog(os.Stderr)
+
+	gc := &GC{
+		DB:  db,
+		Log: log,
+		Scanner: &Scanner{
+			dir:  dir,
+			log:  log,
+			errh: func(err error) { t.Error(err) },
+			drivers: map[string]driver{
+				"qemu": {
+					name: "qemu",
+					categories: map[string]struct{}{
+						"x86_64": {},
+					},
+					aliases: []Alias{
+						{Name: "alpine/latest", Latest: "alpine/3.*"},
+						{Name: "debian/stable", Target: "debian/10"},
+					},
+				},
+			},
+		},
+		Policy: RetentionPolicy{
+			MaxAge: 24 * time.Hour,
+			Keep:   1,
+		},
+	}
+
+	var buf bytes.Buffer
+
+	if err := gc.Run(&buf, true); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := make([]string, 0)
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		path := strings.Fields(line)[0]
+		stale = append(stale, strings.TrimPrefix(path, filepath.Join(dir, "qemu", "x86_64")+"/"))
+	}
+
+	expected := []string{"alpine/3.16", "debian/11"}
+
+	if strings.Join(stale, " ") != strings.Join(expected, " ") {
+		t.Fatalf("expected stale images %v, got %v", expected, stale)
+	}
+}
@@ -5,10 +5,9 @@ go 1.17
 require (
 	crawshaw.io/sqlite v0.3.2
 	github.com/andrewpillar/config v0.0.0-20220312102720-3b07f5c1c031
+	github.com/andrewpillar/query v0.0.0-20220220121330-a382b18255fc
+	github.com/valyala/quicktemplate v1.7.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require (
-	github.com/andrewpillar/query v0.0.0-20220220121330-a382b18255fc // indirect
-	github.com/valyala/bytebufferpool v1.0.0 // indirect
-	github.com/valyala/quicktemplate v1.7.0 // indirect
-)
+require github.com/valyala/bytebufferpool v1.0.0 // indirect
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// groupRule is a rule for matching the name of an image to a group. A rule is
+// either an anchored glob, or an anchored regular expression if prefixed with
+// regexp:, for example,
+//
+//	alpine/*
+//	regexp:debian/1[0-9]
+//
+// a glob may also be prefixed with glob:, for a glob that starts with regexp:.
+type groupRule struct {
+	src   string
+	match func(string) bool
+}
+
+func parseGroupRule(src string) (groupRule, error) {
+	rule := groupRule{
+		src: src,
+	}
+
+	if pattern := strings.TrimPrefix(src, "regexp:"); pattern != src {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+
+		if err != nil {
+			return rule, err
+		}
+
+		rule.match = re.MatchString
+		return rule, nil
+	}
+
+	pattern := strings.TrimPrefix(src, "glob:")
+
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return rule, errors.New("invalid glob " + pattern)
+	}
+
+	rule.match = func(name string) bool {
+		ok, _ := filepath.Match(pattern, name)
+		return ok
+	}
+	return rule, nil
+}
+
+func parseGroupRules(srcs []string) ([]groupRule, error) {
+	rules := make([]groupRule, 0, len(srcs))
+
+	for _, src := range srcs {
+		rule, err := parseGroupRule(src)
+
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// driverGroup is a group of images for a driver. An image is in the group if
+// its name matches any of the group's rules, and none of its exclusions.
+type driverGroup struct {
+	name     string
+	priority int64
+	rules    []groupRule
+	exclude  []groupRule
+}
+
+// match returns the rule of the group that matched the given name, and whether
+// the name matched the group.
+func (g driverGroup) match(name string) (string, bool) {
+	for _, rule := range g.exclude {
+		if rule.match(name) {
+			return "", false
+		}
+	}
+
+	for _, rule := range g.rules {
+		if rule.match(name) {
+			return rule.src, true
+		}
+	}
+	return "", false
+}
+
+// sortGroups sorts the given groups by priority, highest first. Groups with
+// the same priority are kept in the order they were given.
+func sortGroups(groups []driverGroup) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].priority > groups[j].priority
+	})
+}
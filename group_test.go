@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestDriverGroupMatch(t *testing.T) {
+	rules := func(srcs ...string) []groupRule {
+		rr, err := parseGroupRules(srcs)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rr
+	}
+
+	groups := []driverGroup{
+		{name: "Arch", rules: rules("arch", "arch/*")},
+		{name: "Alpine", rules: rules("alpine/*"), exclude: rules("alpine/*-rc*")},
+		{name: "Alpine Edge", rules: rules("regexp:alpine/edge(-[0-9]+)?"), priority: 10},
+		{name: "Debian", rules: rules("regexp:debian/1[0-9]")},
+		{name: "Literal", rules: rules("glob:regexp:*")},
+	}
+
+	sortGroups(groups)
+
+	tests := []struct {
+		name  string
+		group string
+		rule  string
+	}{
+		{"arch", "Arch", "arch"},
+		{"arch/2023", "Arch", "arch/*"},
+		{"archive/x", "", ""},
+		{"archlinux", "", ""},
+		{"alpine/3.17", "Alpine", "alpine/*"},
+		{"alpine/3.18-rc1", "", ""},
+		{"alpine/3.17/uefi", "", ""},
+		{"alpine/edge", "Alpine Edge", "regexp:alpine/edge(-[0-9]+)?"},
+		{"alpine/edge-2", "Alpine Edge", "regexp:alpine/edge(-[0-9]+)?"},
+		{"debian/12", "Debian", "regexp:debian/1[0-9]"},
+		{"debian/12.1", "", ""},
+		{"olddebian/12", "", ""},
+		{"regexp:scratch", "Literal", "glob:regexp:*"},
+	}
+
+	for _, test := range tests {
+		var group, rule string
+
+		for _, grp := range groups {
+			if matched, ok := grp.match(test.name); ok {
+				group = grp.name
+				rule = matched
+				break
+			}
+		}
+
+		if group != test.group || rule != test.rule {
+			t.Errorf("%s: expected group %q by rule %q, got %q by rule %q", test.name, test.group, test.rule, group, rule)
+		}
+	}
+}
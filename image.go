@@ -1,31 +1,166 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
 type Image struct {
-	Path     string    `json:"-"`
-	Driver   string    `json:"driver"`
-	Category string    `json:"category"`
-	Group    string    `json:"group"`
-	Name     string    `json:"name"`
-	Link     string    `json:"link"`
-	ModTime  time.Time `json:"mod_time"`
+	Path      string    `json:"-"`
+	Driver    string    `json:"driver"`
+	Category  string    `json:"category"`
+	Group     string    `json:"group"`
+	GroupRule string    `json:"group_rule,omitempty"`
+	Name      string    `json:"name"`
+	Link      string    `json:"link"`
+	ModTime   time.Time `json:"mod_time"`
+	Size      int64     `json:"size"`
+	Alias     string    `json:"alias,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Tags      []string  `json:"tags"`
+	Meta      Metadata  `json:"meta"`
+	Manifest  Manifest  `json:"manifest"`
+
+	Downloads     int64      `json:"downloads"`
+	DownloadBytes int64      `json:"download_bytes"`
+	LastDownload  *time.Time `json:"last_download"`
+
+	// linkCategory is the category of the image a symbolic link points to.
+	linkCategory string
+
+	// targetPath is the path of the file a symbolic link points to.
+	targetPath string
 }
 
 func (i *Image) Data() (ReadSeekCloser, error) {
 	return os.Open(i.Path)
 }
 
+// readChecksum reads the SHA256 checksum from the given file, in the format
+// written by sha256sum.
+func readChecksum(path string) (string, bool) {
+	b, err := os.ReadFile(path)
+
+	if err != nil {
+		return "", false
+	}
+
+	fields := strings.Fields(string(b))
+
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", false
+	}
+
+	if _, err := hex.DecodeString(fields[0]); err != nil {
+		return "", false
+	}
+	return strings.ToLower(fields[0]), true
+}
+
+// checksum returns the SHA256 checksum stored alongside the file at the given
+// path. A checksum last modified before the file itself is stale, as the file
+// was changed after the checksum was written, so it is ignored.
+func checksum(path string, info os.FileInfo) (string, bool) {
+	sidecar, err := os.Stat(path + checksumExt)
+
+	if err != nil || sidecar.ModTime().Before(info.ModTime()) {
+		return "", false
+	}
+	return readChecksum(path + checksumExt)
+}
+
+// Checksum returns the SHA256 checksum of the image, if it has one stored
+// alongside it that is not stale.
+func (i *Image) Checksum() (string, bool) {
+	path, err := filepath.EvalSymlinks(i.Path)
+
+	if err != nil {
+		return "", false
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return "", false
+	}
+	return checksum(path, info)
+}
+
+// formatSize formats the given number of bytes in the largest unit that
+// keeps the number above 1, for example 1.5 GB.
+func formatSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	size := float64(n)
+	i := 0
+
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+
+	if i == 0 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	return strconv.FormatFloat(size, 'f', 1, 64) + " " + units[i]
+}
+
+// ETag returns the strong entity tag for the image's data. This is derived
+// from the file that the image's path resolves to, so a symbolic link and its
+// target share the same tag, and can be cached as one. If the file has a
+// checksum alongside it that is not stale, then the tag is the checksum, so it
+// only changes when the contents of the image change. Otherwise the tag is
+// derived from the file's inode, size, and modification time.
+func (i *Image) ETag() (string, error) {
+	path, err := filepath.EvalSymlinks(i.Path)
+
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	if sum, ok := checksum(path, info); ok {
+		return `"sha256-` + sum + `"`, nil
+	}
+
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf(`"%x-%x-%x"`, st.Ino, info.Size(), info.ModTime().UnixNano()), nil
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s:%d:%d", path, info.Size(), info.ModTime().UnixNano())
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`, nil
+}
+
+// Endpoint returns the URL path from which the image is served. Each segment
+// of the path is escaped, so the image's name can contain any characters.
 func (i *Image) Endpoint() string {
-	s := "/" + i.Driver
+	segs := []string{i.Driver}
 
 	if i.Category != "" {
-		s += "/" + i.Category
+		segs = append(segs, strings.Split(i.Category, "/")...)
 	}
-	return s + "/" + i.Name
+
+	segs = append(segs, strings.Split(i.Name, "/")...)
+
+	for j, seg := range segs {
+		segs[j] = url.PathEscape(seg)
+	}
+	return "/" + strings.Join(segs, "/")
 }
 
 // Tree offers a hierarchical way of organizing images by their driver, category
@@ -37,11 +172,20 @@ func (i *Image) Endpoint() string {
 // of "qemu", but not category or group, then it will be stored under a tree
 // named "qemu". If an image has no driver, category or group, then it is
 // stored in the root tree, that is, the top-level.
+//
+// A nested category, such as x86_64/uefi, is stored as a sub-tree for each
+// part of the category.
 type Tree struct {
 	name     string
+	path     string
+	category bool
 	order    []string
 	images   []*Image
 	children map[string]*Tree
+
+	// n is the number of images counted in the tree via PutCount, rather
+	// than stored in it.
+	n int
 }
 
 func (t *Tree) get(key string) *Tree {
@@ -52,8 +196,14 @@ func (t *Tree) get(key string) *Tree {
 	t2, ok := t.children[key]
 
 	if !ok {
+		path := key
+
+		if t.path != "" {
+			path = t.path + "/" + key
+		}
+
 		t.order = append(t.order, key)
-		t2 = &Tree{name: key}
+		t2 = &Tree{name: key, path: path}
 		t.children[key] = t2
 	}
 	return t2
@@ -63,16 +213,40 @@ func (t *Tree) put(img *Image) {
 	t.images = append(t.images, img)
 }
 
-func (t *Tree) Put(img *Image) {
+// node returns the sub-tree in which an image with the given driver, category,
+// and group is stored.
+func (t *Tree) node(driver, category, group string) *Tree {
 	root := t
 
-	for _, key := range []string{img.Driver, img.Category, img.Group} {
-		if key == "" {
-			break
-		}
+	if driver == "" {
+		return root
+	}
+
+	root = root.get(driver)
+
+	if category == "" {
+		return root
+	}
+
+	for _, key := range strings.Split(category, "/") {
 		root = root.get(key)
+		root.category = true
 	}
-	root.put(img)
+
+	if group != "" {
+		root = root.get(group)
+	}
+	return root
+}
+
+func (t *Tree) Put(img *Image) {
+	t.node(img.Driver, img.Category, img.Group).put(img)
+}
+
+// PutCount counts the given number of images in the sub-tree for the given
+// driver, category, and group, without storing the images themselves.
+func (t *Tree) PutCount(driver, category, group string, n int) {
+	t.node(driver, category, group).n += n
 }
 
 func (t *Tree) Walk(visit func(string, []*Image)) {
@@ -87,6 +261,31 @@ func (t *Tree) Walk(visit func(string, []*Image)) {
 
 func (t *Tree) Name() string { return t.name }
 
+// Path returns the keys of the tree from the root, joined with a /, for
+// example qemu/x86_64/uefi.
+func (t *Tree) Path() string { return t.path }
+
+// IsCategory reports whether the tree is for a category, or part of a nested
+// category.
+func (t *Tree) IsCategory() bool { return t.category }
+
+// Get returns the sub-tree with the given name, and whether it exists.
+func (t *Tree) Get(key string) (*Tree, bool) {
+	t2, ok := t.children[key]
+	return t2, ok
+}
+
+// Count returns the number of images stored in the tree, including those
+// stored in each of its sub-trees.
+func (t *Tree) Count() int {
+	n := t.n + len(t.images)
+
+	for _, child := range t.children {
+		n += child.Count()
+	}
+	return n
+}
+
 func (t *Tree) Images() []*Image { return t.images }
 
 func (t *Tree) Children() []*Tree {
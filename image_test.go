@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImageETagStaleChecksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "12")
+
+	if err := os.WriteFile(path, []byte("debian 12"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("debian 12"))
+
+	if err := os.WriteFile(path+checksumExt, []byte(hex.EncodeToString(sum[:])+"  12\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	img := &Image{Path: path}
+
+	etag, err := img.ETag()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(etag, `"sha256-`) {
+		t.Fatalf("expected checksum tag, got %s", etag)
+	}
+
+	// Modifying the image after its checksum was written makes the checksum
+	// stale.
+	later := time.Now().Add(time.Minute)
+
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	etag, err = img.ETag()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.HasPrefix(etag, `"sha256-`) {
+		t.Fatalf("expected stale checksum to be ignored, got %s", etag)
+	}
+
+	if _, ok := img.Checksum(); ok {
+		t.Fatal("expected stale checksum to be ignored")
+	}
+}
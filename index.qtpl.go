@@ -5,279 +5,1286 @@
 package main
 
 //line index.qtpl:3
+import (
+	"net/url"
+	"strings"
+)
+
+//line index.qtpl:8
 import (
 	qtio422016 "io"
 
 	qt422016 "github.com/valyala/quicktemplate"
 )
 
-//line index.qtpl:3
+//line index.qtpl:8
 var (
 	_ = qtio422016.Copy
 	_ = qt422016.AcquireByteBuffer
 )
 
-//line index.qtpl:4
+//line index.qtpl:9
 type Index struct {
 	Tree *Tree
 
+	Theme       *Theme
 	DjinnServer string
-	Group       string
+	Groups      []string
+	Tags        []string
+	Search      url.Values
+
+	// Query is the query of the request for the index, this is kept when
+	// changing how the index is sorted, filtered, or which of its categories
+	// are collapsed.
+	Query url.Values
+}
+
+// toggle returns the query string with the given value added to, or removed
+// from the values of the given key.
+func (p *Index) toggle(key, val string) string {
+	q := make(url.Values)
+
+	for k, v := range p.Query {
+		q[k] = v
+	}
+
+	vals := make([]string, 0, len(q[key]))
+
+	for _, v := range q[key] {
+		if v != val {
+			vals = append(vals, v)
+		}
+	}
+
+	if len(vals) == len(q[key]) {
+		vals = append(vals, val)
+	}
+
+	q[key] = vals
+	return "?" + q.Encode()
+}
+
+// with returns the query string with the given values for the given key,
+// replacing any existing values. The key is removed if there are no values.
+func (p *Index) with(key string, vals []string) string {
+	q := make(url.Values)
+
+	for k, v := range p.Query {
+		q[k] = v
+	}
+
+	q.Del(key)
+
+	if len(vals) > 0 {
+		q[key] = vals
+	}
+
+	if len(q) == 0 {
+		return "?"
+	}
+	return "?" + q.Encode()
+}
+
+// collapsed reports whether the category at the given path of the tree is
+// collapsed.
+func (p *Index) collapsed(path string) bool {
+	return hasTag(p.Query["collapse"], path)
+}
+
+// categories returns the paths of every category in the tree of the index.
+func (p *Index) categories() []string {
+	paths := make([]string, 0)
+
+	var walk func(t *Tree)
+
+	walk = func(t *Tree) {
+		if t.IsCategory() {
+			paths = append(paths, t.Path())
+		}
+
+		for _, child := range t.Children() {
+			walk(child)
+		}
+	}
+
+	walk(p.Tree)
+	return paths
+}
+
+// selected reports whether the given image is in one of the groups selected
+// in the index. Every image is selected if no groups are. The images of a
+// group that is not selected are left out of the index, though the header of
+// the group is kept so it can still be selected.
+func (p *Index) selected(img *Image) bool {
+	return len(p.Groups) == 0 || hasTag(p.Groups, img.Group)
+}
+
+// matches reports whether the given image is selected, and matches the filter
+// of the index, this is a case-insensitive substring of the image's name.
+func (p *Index) matches(img *Image) bool {
+	filter := strings.ToLower(p.Query.Get("filter"))
+	return p.selected(img) && strings.Contains(strings.ToLower(img.Name), filter)
+}
+
+// visible returns the number of images in the index that match the filter.
+func (p *Index) visible() int {
+	n := 0
+
+	p.Tree.Walk(func(_ string, imgs []*Image) {
+		for _, img := range imgs {
+			if p.matches(img) {
+				n++
+			}
+		}
+	})
+	return n
+}
+
+// anyMatch reports whether any of the given images match the filter of the
+// index.
+func (p *Index) anyMatch(imgs []*Image) bool {
+	for _, img := range imgs {
+		if p.matches(img) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortColumns are the columns the index can be sorted by, in the order they
+// are shown.
+var sortColumns = []struct {
+	key  string
+	name string
+	desc bool
+}{
+	{"name", "Name", false},
+	{"mod_time", "Modified", true},
+	{"size", "Size", true},
+}
+
+// sortQuery returns the query string for sorting the index by the given
+// column. If the index is already sorted by the column, then the order is
+// reversed, otherwise the column is sorted in its default order.
+func (p *Index) sortQuery(key string, desc bool) string {
+	q := make(url.Values)
+
+	for k, v := range p.Query {
+		q[k] = v
+	}
+
+	if p.Query.Get("sort") == key {
+		desc = p.Query.Get("order") != "desc"
+	}
+
+	order := "asc"
+
+	if desc {
+		order = "desc"
+	}
+
+	q.Set("sort", key)
+	q.Set("order", order)
+
+	return "?" + q.Encode()
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
-//line index.qtpl:13
-func streamrenderImages(qw422016 *qt422016.Writer, group string, imgs []*Image) {
-//line index.qtpl:13
+//line index.qtpl:185
+func (p *Index) streamrenderTags(qw422016 *qt422016.Writer, tags []string) {
+//line index.qtpl:185
 	qw422016.N().S(` `)
-//line index.qtpl:14
-	if len(imgs) > 0 {
-//line index.qtpl:14
-		qw422016.N().S(` <div class="panel"> `)
-//line index.qtpl:16
-		for i, img := range imgs {
-//line index.qtpl:16
+//line index.qtpl:186
+	if len(tags) > 0 {
+//line index.qtpl:186
+		qw422016.N().S(` <div class="tags"> `)
+//line index.qtpl:188
+		for _, tag := range tags {
+//line index.qtpl:188
 			qw422016.N().S(` `)
-//line index.qtpl:17
-			if i == 0 && img.Group != "" {
-//line index.qtpl:17
-				qw422016.N().S(` <div class="panel-header"> <h3>`)
-//line index.qtpl:19
-				qw422016.E().S(img.Group)
-//line index.qtpl:19
-				qw422016.N().S(`</h3> `)
-//line index.qtpl:20
-				if img.Group == group {
-//line index.qtpl:20
-					qw422016.N().S(` <a class="filter filter-active" href="/">`)
-//line index.qtpl:21
-					qw422016.N().S(`<!-- Generated by IcoMoon.io -->
+//line index.qtpl:189
+			if hasTag(p.Tags, tag) {
+//line index.qtpl:189
+				qw422016.N().S(` <a class="chip chip-active" href="`)
+//line index.qtpl:190
+				qw422016.E().S(p.toggle("tag", tag))
+//line index.qtpl:190
+				qw422016.N().S(`" title="Remove filter" data-state>`)
+//line index.qtpl:190
+				qw422016.E().S(tag)
+//line index.qtpl:190
+				qw422016.N().S(`</a> `)
+//line index.qtpl:191
+			} else {
+//line index.qtpl:191
+				qw422016.N().S(` <a class="chip" href="`)
+//line index.qtpl:192
+				qw422016.E().S(p.toggle("tag", tag))
+//line index.qtpl:192
+				qw422016.N().S(`" title="Filter by tag" data-state>`)
+//line index.qtpl:192
+				qw422016.E().S(tag)
+//line index.qtpl:192
+				qw422016.N().S(`</a> `)
+//line index.qtpl:193
+			}
+//line index.qtpl:193
+			qw422016.N().S(` `)
+//line index.qtpl:194
+		}
+//line index.qtpl:194
+		qw422016.N().S(` </div> `)
+//line index.qtpl:196
+	}
+//line index.qtpl:196
+	qw422016.N().S(` `)
+//line index.qtpl:197
+}
+
+//line index.qtpl:197
+func (p *Index) writerenderTags(qq422016 qtio422016.Writer, tags []string) {
+//line index.qtpl:197
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:197
+	p.streamrenderTags(qw422016, tags)
+//line index.qtpl:197
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:197
+}
+
+//line index.qtpl:197
+func (p *Index) renderTags(tags []string) string {
+//line index.qtpl:197
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:197
+	p.writerenderTags(qb422016, tags)
+//line index.qtpl:197
+	qs422016 := string(qb422016.B)
+//line index.qtpl:197
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:197
+	return qs422016
+//line index.qtpl:197
+}
+
+//line index.qtpl:199
+func streamrenderMeta(qw422016 *qt422016.Writer, m Metadata) {
+//line index.qtpl:199
+	qw422016.N().S(` `)
+//line index.qtpl:200
+	if m.Description != "" {
+//line index.qtpl:200
+		qw422016.N().S(` <div class="meta-description">`)
+//line index.qtpl:201
+		qw422016.E().S(m.Description)
+//line index.qtpl:201
+		qw422016.N().S(`</div> `)
+//line index.qtpl:202
+	}
+//line index.qtpl:202
+	qw422016.N().S(` `)
+//line index.qtpl:203
+	if m.OS != "" || m.OSVersion != "" || m.Kernel != "" || m.DefaultUser != "" || m.BuildDate != "" {
+//line index.qtpl:203
+		qw422016.N().S(` <div class="meta muted"> `)
+//line index.qtpl:205
+		if m.OS != "" || m.OSVersion != "" {
+//line index.qtpl:205
+			qw422016.N().S(` <span title="Operating system">`)
+//line index.qtpl:206
+			qw422016.E().S(m.OS)
+//line index.qtpl:206
+			qw422016.N().S(` `)
+//line index.qtpl:206
+			qw422016.E().S(m.OSVersion)
+//line index.qtpl:206
+			qw422016.N().S(`</span> `)
+//line index.qtpl:207
+		}
+//line index.qtpl:207
+		qw422016.N().S(` `)
+//line index.qtpl:208
+		if m.Kernel != "" {
+//line index.qtpl:208
+			qw422016.N().S(` <span title="Kernel">kernel `)
+//line index.qtpl:209
+			qw422016.E().S(m.Kernel)
+//line index.qtpl:209
+			qw422016.N().S(`</span> `)
+//line index.qtpl:210
+		}
+//line index.qtpl:210
+		qw422016.N().S(` `)
+//line index.qtpl:211
+		if m.DefaultUser != "" {
+//line index.qtpl:211
+			qw422016.N().S(` <span title="Default user">user `)
+//line index.qtpl:212
+			qw422016.E().S(m.DefaultUser)
+//line index.qtpl:212
+			qw422016.N().S(`</span> `)
+//line index.qtpl:213
+		}
+//line index.qtpl:213
+		qw422016.N().S(` `)
+//line index.qtpl:214
+		if m.BuildDate != "" {
+//line index.qtpl:214
+			qw422016.N().S(` <span title="Build date">built `)
+//line index.qtpl:215
+			qw422016.E().S(m.BuildDate)
+//line index.qtpl:215
+			qw422016.N().S(`</span> `)
+//line index.qtpl:216
+		}
+//line index.qtpl:216
+		qw422016.N().S(` </div> `)
+//line index.qtpl:218
+	}
+//line index.qtpl:218
+	qw422016.N().S(` `)
+//line index.qtpl:219
+}
+
+//line index.qtpl:219
+func writerenderMeta(qq422016 qtio422016.Writer, m Metadata) {
+//line index.qtpl:219
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:219
+	streamrenderMeta(qw422016, m)
+//line index.qtpl:219
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:219
+}
+
+//line index.qtpl:219
+func renderMeta(m Metadata) string {
+//line index.qtpl:219
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:219
+	writerenderMeta(qb422016, m)
+//line index.qtpl:219
+	qs422016 := string(qb422016.B)
+//line index.qtpl:219
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:219
+	return qs422016
+//line index.qtpl:219
+}
+
+//line index.qtpl:221
+func (p *Index) streamrenderGroupHeader(qw422016 *qt422016.Writer, group string) {
+//line index.qtpl:221
+	qw422016.N().S(` <div class="panel-header"> <h3>`)
+//line index.qtpl:223
+	qw422016.E().S(group)
+//line index.qtpl:223
+	qw422016.N().S(`</h3> `)
+//line index.qtpl:224
+	if hasTag(p.Groups, group) {
+//line index.qtpl:224
+		qw422016.N().S(` <a class="filter filter-active" href="`)
+//line index.qtpl:225
+		qw422016.E().S(p.toggle("group", group))
+//line index.qtpl:225
+		qw422016.N().S(`" title="Remove filter" data-state>`)
+//line index.qtpl:225
+		qw422016.N().S(`<!-- Generated by IcoMoon.io -->
 <svg version="1.1" xmlns="http://www.w3.org/2000/svg" width="19" height="24" viewBox="0 0 19 24">
 <title>filter</title>
 <path d="M18.79 3.951c0.134 0.321 0.067 0.696-0.188 0.938l-6.603 6.603v9.938c0 0.348-0.214 0.656-0.522 0.79-0.107 0.040-0.228 0.067-0.335 0.067-0.228 0-0.442-0.080-0.603-0.254l-3.429-3.429c-0.161-0.161-0.254-0.375-0.254-0.603v-6.509l-6.603-6.603c-0.254-0.241-0.321-0.616-0.188-0.938 0.134-0.308 0.442-0.522 0.79-0.522h17.143c0.348 0 0.656 0.214 0.79 0.522z"></path>
 </svg>
 `)
-//line index.qtpl:21
-					qw422016.N().S(`</a> `)
-//line index.qtpl:22
-				} else {
-//line index.qtpl:22
-					qw422016.N().S(` <a class="filter" href="?group=`)
-//line index.qtpl:23
-					qw422016.E().S(img.Group)
-//line index.qtpl:23
-					qw422016.N().S(`">`)
-//line index.qtpl:23
-					qw422016.N().S(`<!-- Generated by IcoMoon.io -->
+//line index.qtpl:225
+		qw422016.N().S(`</a> `)
+//line index.qtpl:226
+	} else {
+//line index.qtpl:226
+		qw422016.N().S(` <a class="filter" href="`)
+//line index.qtpl:227
+		qw422016.E().S(p.toggle("group", group))
+//line index.qtpl:227
+		qw422016.N().S(`" title="Filter by group" data-state>`)
+//line index.qtpl:227
+		qw422016.N().S(`<!-- Generated by IcoMoon.io -->
 <svg version="1.1" xmlns="http://www.w3.org/2000/svg" width="19" height="24" viewBox="0 0 19 24">
 <title>filter</title>
 <path d="M18.79 3.951c0.134 0.321 0.067 0.696-0.188 0.938l-6.603 6.603v9.938c0 0.348-0.214 0.656-0.522 0.79-0.107 0.040-0.228 0.067-0.335 0.067-0.228 0-0.442-0.080-0.603-0.254l-3.429-3.429c-0.161-0.161-0.254-0.375-0.254-0.603v-6.509l-6.603-6.603c-0.254-0.241-0.321-0.616-0.188-0.938 0.134-0.308 0.442-0.522 0.79-0.522h17.143c0.348 0 0.656 0.214 0.79 0.522z"></path>
 </svg>
 `)
-//line index.qtpl:23
-					qw422016.N().S(`</a> `)
-//line index.qtpl:24
-				}
-//line index.qtpl:24
-				qw422016.N().S(` </div> `)
-//line index.qtpl:26
+//line index.qtpl:227
+		qw422016.N().S(`</a> `)
+//line index.qtpl:228
+	}
+//line index.qtpl:228
+	qw422016.N().S(` </div> `)
+//line index.qtpl:230
+}
+
+//line index.qtpl:230
+func (p *Index) writerenderGroupHeader(qq422016 qtio422016.Writer, group string) {
+//line index.qtpl:230
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:230
+	p.streamrenderGroupHeader(qw422016, group)
+//line index.qtpl:230
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:230
+}
+
+//line index.qtpl:230
+func (p *Index) renderGroupHeader(group string) string {
+//line index.qtpl:230
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:230
+	p.writerenderGroupHeader(qb422016, group)
+//line index.qtpl:230
+	qs422016 := string(qb422016.B)
+//line index.qtpl:230
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:230
+	return qs422016
+//line index.qtpl:230
+}
+
+//line index.qtpl:232
+func (p *Index) streamrenderImages(qw422016 *qt422016.Writer, imgs []*Image) {
+//line index.qtpl:232
+	qw422016.N().S(` `)
+//line index.qtpl:233
+	if len(imgs) > 0 && !p.selected(imgs[0]) {
+//line index.qtpl:233
+		qw422016.N().S(` `)
+//line index.qtpl:234
+		if imgs[0].Group != "" {
+//line index.qtpl:234
+			qw422016.N().S(` <div class="panel"> `)
+//line index.qtpl:236
+			p.streamrenderGroupHeader(qw422016, imgs[0].Group)
+//line index.qtpl:236
+			qw422016.N().S(` </div> `)
+//line index.qtpl:238
+		}
+//line index.qtpl:238
+		qw422016.N().S(` `)
+//line index.qtpl:239
+	} else if len(imgs) > 0 {
+//line index.qtpl:239
+		qw422016.N().S(` <div class="panel" data-panel `)
+//line index.qtpl:240
+		if !p.anyMatch(imgs) {
+//line index.qtpl:240
+			qw422016.N().S(`hidden`)
+//line index.qtpl:240
+		}
+//line index.qtpl:240
+		qw422016.N().S(`> `)
+//line index.qtpl:241
+		for i, img := range imgs {
+//line index.qtpl:241
+			qw422016.N().S(` `)
+//line index.qtpl:242
+			if i == 0 && img.Group != "" {
+//line index.qtpl:242
+				qw422016.N().S(` `)
+//line index.qtpl:243
+				p.streamrenderGroupHeader(qw422016, img.Group)
+//line index.qtpl:243
+				qw422016.N().S(` `)
+//line index.qtpl:244
 			}
-//line index.qtpl:26
-			qw422016.N().S(` <div class="panel-row"> <div class="left"> <a href="`)
-//line index.qtpl:29
+//line index.qtpl:244
+			qw422016.N().S(` <div class="panel-row" data-name="`)
+//line index.qtpl:245
+			qw422016.E().S(img.Name)
+//line index.qtpl:245
+			qw422016.N().S(`" `)
+//line index.qtpl:245
+			if !p.matches(img) {
+//line index.qtpl:245
+				qw422016.N().S(`hidden`)
+//line index.qtpl:245
+			}
+//line index.qtpl:245
+			qw422016.N().S(`> <div class="left"> <a href="`)
+//line index.qtpl:247
 			qw422016.E().S(img.Endpoint())
-//line index.qtpl:29
-			qw422016.N().S(`">`)
-//line index.qtpl:29
+//line index.qtpl:247
+			qw422016.N().S(`?info">`)
+//line index.qtpl:247
 			qw422016.E().S(img.Name)
-//line index.qtpl:29
-			qw422016.N().S(`</a> `)
-//line index.qtpl:30
+//line index.qtpl:247
+			qw422016.N().S(`</a> <a class="download" href="`)
+//line index.qtpl:248
+			qw422016.E().S(img.Endpoint())
+//line index.qtpl:248
+			qw422016.N().S(`" title="Download" download>&darr;</a> <button class="copy copy-small" data-copy="`)
+//line index.qtpl:249
+			qw422016.E().S(img.Manifest.String())
+//line index.qtpl:249
+			qw422016.N().S(`" title="Copy the Djinn manifest for this image">Copy manifest</button> `)
+//line index.qtpl:250
 			if img.Link != "" {
-//line index.qtpl:30
+//line index.qtpl:250
 				qw422016.N().S(` <br/><span class="muted">&rarr; `)
-//line index.qtpl:31
+//line index.qtpl:251
 				qw422016.E().S(img.Link)
-//line index.qtpl:31
+//line index.qtpl:251
 				qw422016.N().S(`</span> `)
-//line index.qtpl:32
+//line index.qtpl:252
 			}
-//line index.qtpl:32
-			qw422016.N().S(` </div> <div class="right muted" title="Last modified">`)
-//line index.qtpl:34
+//line index.qtpl:252
+			qw422016.N().S(` `)
+//line index.qtpl:253
+			streamrenderMeta(qw422016, img.Meta)
+//line index.qtpl:253
+			qw422016.N().S(` `)
+//line index.qtpl:254
+			p.streamrenderTags(qw422016, img.Tags)
+//line index.qtpl:254
+			qw422016.N().S(` </div> <div class="right muted"> <span title="`)
+//line index.qtpl:257
+			qw422016.N().DL(img.Size)
+//line index.qtpl:257
+			qw422016.N().S(` bytes">`)
+//line index.qtpl:257
+			qw422016.E().S(formatSize(img.Size))
+//line index.qtpl:257
+			qw422016.N().S(`</span><br/> <span title="Last modified">`)
+//line index.qtpl:258
 			qw422016.E().S(img.ModTime.Format("Mon, 02 Jan 2006"))
-//line index.qtpl:34
-			qw422016.N().S(`</div> </div> `)
-//line index.qtpl:36
+//line index.qtpl:258
+			qw422016.N().S(`</span><br/> `)
+//line index.qtpl:259
+			if img.LastDownload != nil {
+//line index.qtpl:259
+				qw422016.N().S(` <span title="Last pulled">pulled `)
+//line index.qtpl:260
+				qw422016.E().S(img.LastDownload.Format("Mon, 02 Jan 2006"))
+//line index.qtpl:260
+				qw422016.N().S(`</span> `)
+//line index.qtpl:261
+			} else {
+//line index.qtpl:261
+				qw422016.N().S(` <span title="Last pulled">never pulled</span> `)
+//line index.qtpl:263
+			}
+//line index.qtpl:263
+			qw422016.N().S(` </div> </div> `)
+//line index.qtpl:266
 		}
-//line index.qtpl:36
+//line index.qtpl:266
 		qw422016.N().S(` </div> `)
-//line index.qtpl:38
+//line index.qtpl:268
 	}
-//line index.qtpl:38
+//line index.qtpl:268
 	qw422016.N().S(` `)
-//line index.qtpl:39
+//line index.qtpl:269
 }
 
-//line index.qtpl:39
-func writerenderImages(qq422016 qtio422016.Writer, group string, imgs []*Image) {
-//line index.qtpl:39
+//line index.qtpl:269
+func (p *Index) writerenderImages(qq422016 qtio422016.Writer, imgs []*Image) {
+//line index.qtpl:269
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line index.qtpl:39
-	streamrenderImages(qw422016, group, imgs)
-//line index.qtpl:39
+//line index.qtpl:269
+	p.streamrenderImages(qw422016, imgs)
+//line index.qtpl:269
 	qt422016.ReleaseWriter(qw422016)
-//line index.qtpl:39
+//line index.qtpl:269
 }
 
-//line index.qtpl:39
-func renderImages(group string, imgs []*Image) string {
-//line index.qtpl:39
+//line index.qtpl:269
+func (p *Index) renderImages(imgs []*Image) string {
+//line index.qtpl:269
 	qb422016 := qt422016.AcquireByteBuffer()
-//line index.qtpl:39
-	writerenderImages(qb422016, group, imgs)
-//line index.qtpl:39
+//line index.qtpl:269
+	p.writerenderImages(qb422016, imgs)
+//line index.qtpl:269
 	qs422016 := string(qb422016.B)
-//line index.qtpl:39
+//line index.qtpl:269
 	qt422016.ReleaseByteBuffer(qb422016)
-//line index.qtpl:39
+//line index.qtpl:269
 	return qs422016
-//line index.qtpl:39
+//line index.qtpl:269
 }
 
-//line index.qtpl:41
-func streamrenderTree(qw422016 *qt422016.Writer, group string, depth int, t *Tree) {
-//line index.qtpl:41
+//line index.qtpl:271
+func (p *Index) streamrenderTree(qw422016 *qt422016.Writer, depth int, t *Tree) {
+//line index.qtpl:271
 	qw422016.N().S(` `)
-//line index.qtpl:42
+//line index.qtpl:272
 	if depth == 1 {
-//line index.qtpl:42
+//line index.qtpl:272
 		qw422016.N().S(` <h2>`)
-//line index.qtpl:43
+//line index.qtpl:273
 		qw422016.E().S(t.Name())
-//line index.qtpl:43
+//line index.qtpl:273
 		qw422016.N().S(`</h2> `)
-//line index.qtpl:44
-	} else if depth == 2 {
-//line index.qtpl:44
-		qw422016.N().S(` <h3 class="accordion accordion-open muted" data-accordion="`)
-//line index.qtpl:45
-		qw422016.E().S(t.Name())
-//line index.qtpl:45
-		qw422016.N().S(`">`)
-//line index.qtpl:45
-		qw422016.E().S(t.Name())
-//line index.qtpl:45
-		qw422016.N().S(`</h3> `)
-//line index.qtpl:46
+//line index.qtpl:274
+	} else if t.IsCategory() {
+//line index.qtpl:274
+		qw422016.N().S(` <h3 class="muted"> `)
+//line index.qtpl:276
+		if p.collapsed(t.Path()) {
+//line index.qtpl:276
+			qw422016.N().S(` <a class="accordion accordion-closed" href="`)
+//line index.qtpl:277
+			qw422016.E().S(p.toggle("collapse", t.Path()))
+//line index.qtpl:277
+			qw422016.N().S(`" data-accordion="`)
+//line index.qtpl:277
+			qw422016.E().S(t.Path())
+//line index.qtpl:277
+			qw422016.N().S(`">`)
+//line index.qtpl:277
+			qw422016.E().S(t.Name())
+//line index.qtpl:277
+			qw422016.N().S(`</a> `)
+//line index.qtpl:278
+		} else {
+//line index.qtpl:278
+			qw422016.N().S(` <a class="accordion accordion-open" href="`)
+//line index.qtpl:279
+			qw422016.E().S(p.toggle("collapse", t.Path()))
+//line index.qtpl:279
+			qw422016.N().S(`" data-accordion="`)
+//line index.qtpl:279
+			qw422016.E().S(t.Path())
+//line index.qtpl:279
+			qw422016.N().S(`">`)
+//line index.qtpl:279
+			qw422016.E().S(t.Name())
+//line index.qtpl:279
+			qw422016.N().S(`</a> `)
+//line index.qtpl:280
+		}
+//line index.qtpl:280
+		qw422016.N().S(` </h3> `)
+//line index.qtpl:282
 	}
-//line index.qtpl:46
+//line index.qtpl:282
 	qw422016.N().S(` `)
-//line index.qtpl:47
-	if t.HasChildren() {
-//line index.qtpl:47
+//line index.qtpl:283
+	if t.IsCategory() {
+//line index.qtpl:283
 		qw422016.N().S(` <div data-accordion-body="`)
-//line index.qtpl:48
-		qw422016.E().S(t.Name())
-//line index.qtpl:48
-		qw422016.N().S(`"> `)
-//line index.qtpl:49
-		for _, child := range t.Children() {
-//line index.qtpl:49
+//line index.qtpl:284
+		qw422016.E().S(t.Path())
+//line index.qtpl:284
+		qw422016.N().S(`" `)
+//line index.qtpl:284
+		if p.collapsed(t.Path()) {
+//line index.qtpl:284
+			qw422016.N().S(`hidden`)
+//line index.qtpl:284
+		}
+//line index.qtpl:284
+		qw422016.N().S(`> `)
+//line index.qtpl:285
+		p.streamrenderTreeBody(qw422016, depth, t)
+//line index.qtpl:285
+		qw422016.N().S(` </div> `)
+//line index.qtpl:287
+	} else {
+//line index.qtpl:287
+		qw422016.N().S(` `)
+//line index.qtpl:288
+		p.streamrenderTreeBody(qw422016, depth, t)
+//line index.qtpl:288
+		qw422016.N().S(` `)
+//line index.qtpl:289
+	}
+//line index.qtpl:289
+	qw422016.N().S(` `)
+//line index.qtpl:290
+}
+
+//line index.qtpl:290
+func (p *Index) writerenderTree(qq422016 qtio422016.Writer, depth int, t *Tree) {
+//line index.qtpl:290
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:290
+	p.streamrenderTree(qw422016, depth, t)
+//line index.qtpl:290
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:290
+}
+
+//line index.qtpl:290
+func (p *Index) renderTree(depth int, t *Tree) string {
+//line index.qtpl:290
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:290
+	p.writerenderTree(qb422016, depth, t)
+//line index.qtpl:290
+	qs422016 := string(qb422016.B)
+//line index.qtpl:290
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:290
+	return qs422016
+//line index.qtpl:290
+}
+
+//line index.qtpl:292
+func (p *Index) streamrenderTreeBody(qw422016 *qt422016.Writer, depth int, t *Tree) {
+//line index.qtpl:292
+	qw422016.N().S(` `)
+//line index.qtpl:293
+	for _, child := range t.Children() {
+//line index.qtpl:293
+		qw422016.N().S(` `)
+//line index.qtpl:294
+		p.streamrenderTree(qw422016, depth+1, child)
+//line index.qtpl:294
+		qw422016.N().S(` `)
+//line index.qtpl:295
+	}
+//line index.qtpl:295
+	qw422016.N().S(` `)
+//line index.qtpl:296
+	p.streamrenderImages(qw422016, t.Images())
+//line index.qtpl:296
+	qw422016.N().S(` `)
+//line index.qtpl:297
+}
+
+//line index.qtpl:297
+func (p *Index) writerenderTreeBody(qq422016 qtio422016.Writer, depth int, t *Tree) {
+//line index.qtpl:297
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:297
+	p.streamrenderTreeBody(qw422016, depth, t)
+//line index.qtpl:297
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:297
+}
+
+//line index.qtpl:297
+func (p *Index) renderTreeBody(depth int, t *Tree) string {
+//line index.qtpl:297
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:297
+	p.writerenderTreeBody(qb422016, depth, t)
+//line index.qtpl:297
+	qs422016 := string(qb422016.B)
+//line index.qtpl:297
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:297
+	return qs422016
+//line index.qtpl:297
+}
+
+//line index.qtpl:299
+func (p *Index) streamrenderFilter(qw422016 *qt422016.Writer) {
+//line index.qtpl:299
+	qw422016.N().S(` <form class="filter-bar" method="GET"> `)
+//line index.qtpl:301
+	for key, vals := range p.Query {
+//line index.qtpl:301
+		qw422016.N().S(` `)
+//line index.qtpl:302
+		if key != "filter" {
+//line index.qtpl:302
 			qw422016.N().S(` `)
-//line index.qtpl:50
-			streamrenderTree(qw422016, group, depth+1, child)
-//line index.qtpl:50
+//line index.qtpl:303
+			for _, val := range vals {
+//line index.qtpl:303
+				qw422016.N().S(` <input type="hidden" name="`)
+//line index.qtpl:304
+				qw422016.E().S(key)
+//line index.qtpl:304
+				qw422016.N().S(`" value="`)
+//line index.qtpl:304
+				qw422016.E().S(val)
+//line index.qtpl:304
+				qw422016.N().S(`"/> `)
+//line index.qtpl:305
+			}
+//line index.qtpl:305
 			qw422016.N().S(` `)
-//line index.qtpl:51
+//line index.qtpl:306
 		}
-//line index.qtpl:51
-		qw422016.N().S(` </div> `)
-//line index.qtpl:53
+//line index.qtpl:306
+		qw422016.N().S(` `)
+//line index.qtpl:307
+	}
+//line index.qtpl:307
+	qw422016.N().S(` <input type="text" name="filter" value="`)
+//line index.qtpl:308
+	qw422016.E().S(p.Query.Get("filter"))
+//line index.qtpl:308
+	qw422016.N().S(`" placeholder="Filter images on this page" data-filter/> <a href="`)
+//line index.qtpl:309
+	qw422016.E().S(p.with("collapse", nil))
+//line index.qtpl:309
+	qw422016.N().S(`" data-collapse-all="expand">Expand all</a> <a href="`)
+//line index.qtpl:310
+	qw422016.E().S(p.with("collapse", p.categories()))
+//line index.qtpl:310
+	qw422016.N().S(`" data-collapse-all="collapse">Collapse all</a> </form> `)
+//line index.qtpl:312
+	if p.visible() == 0 {
+//line index.qtpl:312
+		qw422016.N().S(` <p class="muted filter-empty" data-filter-empty>No images match.</p> `)
+//line index.qtpl:314
+	} else {
+//line index.qtpl:314
+		qw422016.N().S(` <p class="muted filter-empty" data-filter-empty hidden>No images match.</p> `)
+//line index.qtpl:316
 	}
-//line index.qtpl:53
+//line index.qtpl:316
 	qw422016.N().S(` `)
-//line index.qtpl:54
-	streamrenderImages(qw422016, group, t.Images())
-//line index.qtpl:54
+//line index.qtpl:317
+}
+
+//line index.qtpl:317
+func (p *Index) writerenderFilter(qq422016 qtio422016.Writer) {
+//line index.qtpl:317
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:317
+	p.streamrenderFilter(qw422016)
+//line index.qtpl:317
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:317
+}
+
+//line index.qtpl:317
+func (p *Index) renderFilter() string {
+//line index.qtpl:317
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:317
+	p.writerenderFilter(qb422016)
+//line index.qtpl:317
+	qs422016 := string(qb422016.B)
+//line index.qtpl:317
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:317
+	return qs422016
+//line index.qtpl:317
+}
+
+//line index.qtpl:319
+func streamrenderSearch(qw422016 *qt422016.Writer, q url.Values) {
+//line index.qtpl:319
+	qw422016.N().S(` <form class="search" action="/search" method="GET"> <div class="search-bar"> <input type="text" name="q" value="`)
+//line index.qtpl:322
+	qw422016.E().S(q.Get("q"))
+//line index.qtpl:322
+	qw422016.N().S(`" placeholder="Search images, e.g. debian or debian/*"/> <button type="submit">Search</button> </div> `)
+//line index.qtpl:325
+	if q.Get("category") != "" || q.Get("group") != "" || q.Get("tag") != "" || q.Get("modified_after") != "" || q.Get("modified_before") != "" || q.Get("min_size") != "" || q.Get("max_size") != "" {
+//line index.qtpl:325
+		qw422016.N().S(` <details open> `)
+//line index.qtpl:327
+	} else {
+//line index.qtpl:327
+		qw422016.N().S(` <details> `)
+//line index.qtpl:329
+	}
+//line index.qtpl:329
+	qw422016.N().S(` <summary class="muted">Filters</summary> <div class="search-filters"> <label>Category <input type="text" name="category" value="`)
+//line index.qtpl:332
+	qw422016.E().S(q.Get("category"))
+//line index.qtpl:332
+	qw422016.N().S(`"/></label> <label>Group <input type="text" name="group" value="`)
+//line index.qtpl:333
+	qw422016.E().S(q.Get("group"))
+//line index.qtpl:333
+	qw422016.N().S(`"/></label> <label>Tag <input type="text" name="tag" value="`)
+//line index.qtpl:334
+	qw422016.E().S(q.Get("tag"))
+//line index.qtpl:334
+	qw422016.N().S(`"/></label> <label>Modified after <input type="date" name="modified_after" value="`)
+//line index.qtpl:335
+	qw422016.E().S(q.Get("modified_after"))
+//line index.qtpl:335
+	qw422016.N().S(`"/></label> <label>Modified before <input type="date" name="modified_before" value="`)
+//line index.qtpl:336
+	qw422016.E().S(q.Get("modified_before"))
+//line index.qtpl:336
+	qw422016.N().S(`"/></label> <label>Min size <input type="text" name="min_size" value="`)
+//line index.qtpl:337
+	qw422016.E().S(q.Get("min_size"))
+//line index.qtpl:337
+	qw422016.N().S(`" placeholder="e.g. 500MB"/></label> <label>Max size <input type="text" name="max_size" value="`)
+//line index.qtpl:338
+	qw422016.E().S(q.Get("max_size"))
+//line index.qtpl:338
+	qw422016.N().S(`" placeholder="e.g. 2GB"/></label> </div> </details> </form> `)
+//line index.qtpl:342
+}
+
+//line index.qtpl:342
+func writerenderSearch(qq422016 qtio422016.Writer, q url.Values) {
+//line index.qtpl:342
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:342
+	streamrenderSearch(qw422016, q)
+//line index.qtpl:342
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:342
+}
+
+//line index.qtpl:342
+func renderSearch(q url.Values) string {
+//line index.qtpl:342
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:342
+	writerenderSearch(qb422016, q)
+//line index.qtpl:342
+	qs422016 := string(qb422016.B)
+//line index.qtpl:342
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:342
+	return qs422016
+//line index.qtpl:342
+}
+
+//line index.qtpl:344
+func (p *Index) streamrenderSort(qw422016 *qt422016.Writer) {
+//line index.qtpl:344
+	qw422016.N().S(` <div class="sort muted"> Sort by `)
+//line index.qtpl:347
+	for _, col := range sortColumns {
+//line index.qtpl:347
+		qw422016.N().S(` `)
+//line index.qtpl:348
+		if p.Query.Get("sort") == col.key {
+//line index.qtpl:348
+			qw422016.N().S(` <a class="sort-active" href="`)
+//line index.qtpl:349
+			qw422016.E().S(p.sortQuery(col.key, col.desc))
+//line index.qtpl:349
+			qw422016.N().S(`" data-state> `)
+//line index.qtpl:350
+			qw422016.E().S(col.name)
+//line index.qtpl:350
+			qw422016.N().S(` `)
+//line index.qtpl:351
+			if p.Query.Get("order") == "desc" {
+//line index.qtpl:351
+				qw422016.N().S(`&darr;`)
+//line index.qtpl:351
+			} else {
+//line index.qtpl:351
+				qw422016.N().S(`&uarr;`)
+//line index.qtpl:351
+			}
+//line index.qtpl:351
+			qw422016.N().S(` </a> `)
+//line index.qtpl:353
+		} else {
+//line index.qtpl:353
+			qw422016.N().S(` <a href="`)
+//line index.qtpl:354
+			qw422016.E().S(p.sortQuery(col.key, col.desc))
+//line index.qtpl:354
+			qw422016.N().S(`" data-state>`)
+//line index.qtpl:354
+			qw422016.E().S(col.name)
+//line index.qtpl:354
+			qw422016.N().S(`</a> `)
+//line index.qtpl:355
+		}
+//line index.qtpl:355
+		qw422016.N().S(` `)
+//line index.qtpl:356
+	}
+//line index.qtpl:356
+	qw422016.N().S(` </div> `)
+//line index.qtpl:358
+}
+
+//line index.qtpl:358
+func (p *Index) writerenderSort(qq422016 qtio422016.Writer) {
+//line index.qtpl:358
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:358
+	p.streamrenderSort(qw422016)
+//line index.qtpl:358
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:358
+}
+
+//line index.qtpl:358
+func (p *Index) renderSort() string {
+//line index.qtpl:358
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:358
+	p.writerenderSort(qb422016)
+//line index.qtpl:358
+	qs422016 := string(qb422016.B)
+//line index.qtpl:358
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:358
+	return qs422016
+//line index.qtpl:358
+}
+
+//line index.qtpl:360
+func streamrenderHead(qw422016 *qt422016.Writer, theme *Theme, title string) {
+//line index.qtpl:360
+	qw422016.N().S(` <meta charset="utf-8"> <meta content="width=device-width, initial-scale=1" name="viewport"> <meta name="color-scheme" content="light dark"> <link rel="alternate" type="application/atom+xml" href="/feed" title="`)
+//line index.qtpl:364
+	qw422016.E().S(theme.title())
+//line index.qtpl:364
+	qw422016.N().S(`"> `)
+//line index.qtpl:365
+	if title != "" {
+//line index.qtpl:365
+		qw422016.N().S(` <title>`)
+//line index.qtpl:366
+		qw422016.E().S(title)
+//line index.qtpl:366
+		qw422016.N().S(` - `)
+//line index.qtpl:366
+		qw422016.E().S(theme.title())
+//line index.qtpl:366
+		qw422016.N().S(`</title> `)
+//line index.qtpl:367
+	} else {
+//line index.qtpl:367
+		qw422016.N().S(` <title>`)
+//line index.qtpl:368
+		qw422016.E().S(theme.title())
+//line index.qtpl:368
+		qw422016.N().S(`</title> `)
+//line index.qtpl:369
+	}
+//line index.qtpl:369
+	qw422016.N().S(` <style type="text/css">`)
+//line index.qtpl:370
+	qw422016.N().S(`* {margin: 0;padding: 0;}body {font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif, "Apple Color Emoji", "Segoe UI Emoji", "Sego UI Symbol";font-size: 14px;background: #eee;color: #444;}a {color: #146de0;cursor: pointer;text-decoration: none;}a:hover {text-decoration: underline;}.title {text-align: center;}.logo {margin-top: -5px;margin-right: 30px;margin-bottom: 15px;display: inline-block;vertical-align: middle;width: 0;}.logo .handle {margin-left: -3px;border-style: solid;border-width: 2px 0px 8px 7px;border-color: transparent transparent transparent #cacaca;}.logo .lid {margin-bottom: -20px;margin-left: 13px;border-style: solid;border-width: 5px 0px 7px 5px;border-color: transparent transparent transparent #cacaca;}.logo .lantern {margin-left: -5px;border-style: solid;border-width: 15px 15px 35px 0px;border-color: transparent #cacaca transparent transparent;}h1 {margin-bottom: 15px;}h3 {margin-top: 10px;}.accordion {cursor: pointer;font-style: italic;}.accordion-open:before {content: '-';margin-right: 10px;}.accordion-closed:before {content: '+';margin-right: 10px;}.accordion:hover {color: #8f8f8f;}.tree-header {margin-top: 15px;}ul.tree {margin-left: 30px;}ul.tree li {list-style: none;}.left {float: left;}.right {float: right;}.right.muted {text-align: right;}.muted {color: #9f9f9f;}.pill {display: inline-block;text-align: center;padding: 3px;padding-left: 10px;padding-right: 10px;vertical-align: middle;background: #61a0ea;color: #fff;border-radius: 25px;}.pill:hover {text-decoration: none;background: #5090d9;}.panel + .panel {margin-top: 15px;}.panel {background: #fff;border-radius: 3px;box-shadow: 0px 2px 4px 0px rgba(0, 0, 0, 0.1);}.panel-header {border-bottom: solid 1px #e4e4e4;overflow: auto;}.panel-header h3 {padding: 10px;font-weight: 700;float: left;}.panel-header .filter {float: right;display: inline-block;font-size: 10px;box-sizing: border-box;padding: 10px;}.panel-header .filter:hover svg {fill: #afafaf;}.panel-header .filter svg {width: 15px;fill: #e4e4e4;}.panel-header .filter-active svg {fill: #afafaf;}.panel-header .filter-active:hover svg {fill: #e4e4e4;}.panel .panel-body {padding: 15px;}.panel .panel-row {overflow: auto;padding: 10px;padding-left: 15px;padding-right: 15px;}.panel-row + .panel-row {border-top: solid 1px #e4e4e4;}.search {margin-bottom: 15px;}.search-bar {display: flex;}.search input[type="text"], .search input[type="date"] {border: solid 1px #e4e4e4;border-radius: 3px;box-sizing: border-box;font-size: 14px;padding: 8px;}.search-bar input[type="text"] {flex: 1;}.search button {background: #61a0ea;border: none;border-radius: 3px;color: #fff;cursor: pointer;font-size: 14px;margin-left: 5px;padding: 8px 15px;}.search button:hover {background: #5090d9;}.search summary {cursor: pointer;margin-top: 5px;}.search-filters {display: flex;flex-wrap: wrap;}.search-filters label {box-sizing: border-box;padding: 5px 5px 0 0;width: 50%;}.search-filters input {display: block;margin-top: 3px;width: 100%;}.content {margin: 0 auto;max-width: 800px;padding: 20px;}.col-75 {width: 75%;box-sizing: border-box;}.col-25 {width: 25%;box-sizing: border-box;}.col-left {float: left;padding-right: 5px;}.col-right {float: right;padding-left: 5px;}.overflow {overflow: auto;padding-bottom: 5px;}@media (max-width: 1100px) {.col-75 {margin-bottom: 10px;width: 100%;}.col-25 {margin-bottom: 10px;width: 100%;}.col-left {padding-right: 0px;float: none;}.col-right {padding-left: 0px;float: none;}}.error .panel-body p + p {margin-top: 10px;}[data-accordion-body] [data-accordion-body] .accordion,[data-accordion-body] [data-accordion-body] [data-accordion-body] {margin-left: 15px;}.tags {margin-top: 5px;}.chip {display: inline-block;border: solid 1px #e4e4e4;border-radius: 25px;color: #8f8f8f;font-size: 12px;margin-right: 5px;padding: 1px 8px;}.chip:hover, .chip-active {background: #61a0ea;border-color: #61a0ea;color: #fff;text-decoration: none;}.chip-active:hover {background: #fff;border-color: #e4e4e4;color: #8f8f8f;}.meta-description {margin-top: 3px;}.meta {font-size: 12px;margin-top: 3px;}.meta span + span:before {content: '\00b7';margin: 0 5px;}.panel-row .download {color: #9f9f9f;margin-left: 5px;}.panel-row .download:hover {color: #61a0ea;text-decoration: none;}.detail .panel-header .download {float: right;margin: 7px 10px;}.detail-table {border-collapse: collapse;margin-top: 10px;width: 100%;}.detail-table th, .detail-table td {padding: 5px 0;text-align: left;vertical-align: top;}.detail-table th {font-weight: 700;width: 150px;}.detail-table code {word-break: break-all;}.detail h4 {font-weight: 700;margin-top: 15px;}.manifest {background: #f7f7f7;border: solid 1px #e4e4e4;border-radius: 3px;margin: 10px 0;padding: 10px;}.copy {background: #fff;border: solid 1px #e4e4e4;border-radius: 3px;color: #8f8f8f;cursor: pointer;padding: 3px 10px;}.copy:hover {border-color: #61a0ea;color: #61a0ea;}.copy-small {font-size: 11px;margin-left: 5px;padding: 0 6px;}.sort {font-size: 12px;margin-bottom: 15px;text-align: right;}.sort a {color: #9f9f9f;margin-left: 10px;}.sort a.sort-active {color: #146de0;}.accordion {color: inherit;}.filter-bar {align-items: center;display: flex;margin-bottom: 10px;}.filter-bar input[type="text"] {border: solid 1px #e4e4e4;border-radius: 3px;box-sizing: border-box;flex: 1;font-size: 14px;padding: 6px 8px;}.filter-bar a {color: #9f9f9f;font-size: 12px;margin-left: 10px;}.filter-empty {margin: 15px 0;text-align: center;}.logo-img {display: inline-block;margin-bottom: 15px;margin-right: 15px;max-height: 40px;vertical-align: middle;}.links {font-size: 12px;margin-top: 20px;text-align: center;}.links a {color: #9f9f9f;margin: 0 5px;}@media (prefers-color-scheme: dark) {body {background: #1b1b1d;color: #d4d4d4;}a {color: #6ea8f0;}.muted, .links a, .sort a, .filter-bar a, .panel-row .download {color: #8a8a8a;}.panel, .copy, .chip-active:hover {background: #262629;}.panel {box-shadow: 0px 2px 4px 0px rgba(0, 0, 0, 0.4);}.panel-header, .panel-row + .panel-row {border-color: #38383c;}.chip, .copy, .chip-active:hover, .manifest {border-color: #38383c;}.manifest {background: #1f1f22;}.search input[type="text"], .search input[type="date"], .filter-bar input[type="text"] {background: #262629;border-color: #38383c;color: #d4d4d4;}.panel-header .filter svg {fill: #48484c;}.logo .handle, .logo .lid {border-color: transparent transparent transparent #5a5a5e;}.logo .lantern {border-color: transparent #5a5a5e transparent transparent;}}`)
+//line index.qtpl:370
+	qw422016.N().S(`</style> `)
+//line index.qtpl:371
+	if theme.css() != "" {
+//line index.qtpl:371
+		qw422016.N().S(` <style type="text/css">`)
+//line index.qtpl:372
+		qw422016.N().S(theme.css())
+//line index.qtpl:372
+		qw422016.N().S(`</style> `)
+//line index.qtpl:373
+	}
+//line index.qtpl:373
 	qw422016.N().S(` `)
-//line index.qtpl:55
+//line index.qtpl:374
 }
 
-//line index.qtpl:55
-func writerenderTree(qq422016 qtio422016.Writer, group string, depth int, t *Tree) {
-//line index.qtpl:55
+//line index.qtpl:374
+func writerenderHead(qq422016 qtio422016.Writer, theme *Theme, title string) {
+//line index.qtpl:374
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line index.qtpl:55
-	streamrenderTree(qw422016, group, depth, t)
-//line index.qtpl:55
+//line index.qtpl:374
+	streamrenderHead(qw422016, theme, title)
+//line index.qtpl:374
 	qt422016.ReleaseWriter(qw422016)
-//line index.qtpl:55
+//line index.qtpl:374
 }
 
-//line index.qtpl:55
-func renderTree(group string, depth int, t *Tree) string {
-//line index.qtpl:55
+//line index.qtpl:374
+func renderHead(theme *Theme, title string) string {
+//line index.qtpl:374
 	qb422016 := qt422016.AcquireByteBuffer()
-//line index.qtpl:55
-	writerenderTree(qb422016, group, depth, t)
-//line index.qtpl:55
+//line index.qtpl:374
+	writerenderHead(qb422016, theme, title)
+//line index.qtpl:374
 	qs422016 := string(qb422016.B)
-//line index.qtpl:55
+//line index.qtpl:374
 	qt422016.ReleaseByteBuffer(qb422016)
-//line index.qtpl:55
+//line index.qtpl:374
 	return qs422016
-//line index.qtpl:55
+//line index.qtpl:374
 }
 
-//line index.qtpl:57
-func (p *Index) StreamRender(qw422016 *qt422016.Writer) {
-//line index.qtpl:57
-	qw422016.N().S(` <!DOCTYPE HTML> <html lang="en"> <head> <meta charset="utf-8"> <meta content="width=device-width, initial-scale=1" name="viewport"> <title>Djinn CI Images</title> <style type="text/css">`)
-//line index.qtpl:64
-	qw422016.N().S(`* {margin: 0;padding: 0;}body {font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, Helvetica, Arial, sans-serif, "Apple Color Emoji", "Segoe UI Emoji", "Sego UI Symbol";font-size: 14px;background: #eee;color: #444;}a {color: #146de0;cursor: pointer;text-decoration: none;}a:hover {text-decoration: underline;}.title {text-align: center;}.logo {margin-top: -5px;margin-right: 30px;margin-bottom: 15px;display: inline-block;vertical-align: middle;width: 0;}.logo .handle {margin-left: -3px;border-style: solid;border-width: 2px 0px 8px 7px;border-color: transparent transparent transparent #cacaca;}.logo .lid {margin-bottom: -20px;margin-left: 13px;border-style: solid;border-width: 5px 0px 7px 5px;border-color: transparent transparent transparent #cacaca;}.logo .lantern {margin-left: -5px;border-style: solid;border-width: 15px 15px 35px 0px;border-color: transparent #cacaca transparent transparent;}h1 {margin-bottom: 15px;}h3 {margin-top: 10px;}.accordion {cursor: pointer;font-style: italic;}.accordion-open:before {content: '-';margin-right: 10px;}.accordion-closed:before {content: '+';margin-right: 10px;}.accordion:hover {color: #8f8f8f;}.tree-header {margin-top: 15px;}ul.tree {margin-left: 30px;}ul.tree li {list-style: none;}.left {float: left;}.right {float: right;}.muted {color: #9f9f9f;}.pill {display: inline-block;text-align: center;padding: 3px;padding-left: 10px;padding-right: 10px;vertical-align: middle;background: #61a0ea;color: #fff;border-radius: 25px;}.pill:hover {text-decoration: none;background: #5090d9;}.panel + .panel {margin-top: 15px;}.panel {background: #fff;border-radius: 3px;box-shadow: 0px 2px 4px 0px rgba(0, 0, 0, 0.1);}.panel-header {border-bottom: solid 1px #e4e4e4;overflow: auto;}.panel-header h3 {padding: 10px;font-weight: 700;float: left;}.panel-header .filter {float: right;display: inline-block;font-size: 10px;box-sizing: border-box;padding: 10px;}.panel-header .filter:hover svg {fill: #afafaf;}.panel-header .filter svg {width: 15px;fill: #e4e4e4;}.panel-header .filter-active svg {fill: #afafaf;}.panel-header .filter-active:hover svg {fill: #e4e4e4;}.panel .panel-body {padding: 15px;}.panel .panel-row {overflow: auto;padding: 10px;padding-left: 15px;padding-right: 15px;}.panel-row + .panel-row {border-top: solid 1px #e4e4e4;}.content {margin: 0 auto;max-width: 800px;padding: 20px;}.col-75 {width: 75%;box-sizing: border-box;}.col-25 {width: 25%;box-sizing: border-box;}.col-left {float: left;padding-right: 5px;}.col-right {float: right;padding-left: 5px;}.overflow {overflow: auto;padding-bottom: 5px;}@media (max-width: 1100px) {.col-75 {margin-bottom: 10px;width: 100%;}.col-25 {margin-bottom: 10px;width: 100%;}.col-left {padding-right: 0px;float: none;}.col-right {padding-left: 0px;float: none;}}`)
-//line index.qtpl:64
-	qw422016.N().S(`</style> </head> <body> <div class="content"> <div class="title"> <div class="logo"> <div class="handle"></div> <div class="lid"></div> <div class="lantern"></div> </div> <h2>Djinn CI Images</h2> `)
-//line index.qtpl:75
-	if p.DjinnServer != "" {
-//line index.qtpl:75
+//line index.qtpl:376
+func streamrenderTitle(qw422016 *qt422016.Writer, theme *Theme, djinnServer string) {
+//line index.qtpl:376
+	qw422016.N().S(` <div class="title"> `)
+//line index.qtpl:378
+	if theme.logo() != "" {
+//line index.qtpl:378
+		qw422016.N().S(` <img class="logo-img" src="`)
+//line index.qtpl:379
+		qw422016.E().S(theme.logo())
+//line index.qtpl:379
+		qw422016.N().S(`" alt=""/> `)
+//line index.qtpl:380
+	} else {
+//line index.qtpl:380
+		qw422016.N().S(` <div class="logo"> <div class="handle"></div> <div class="lid"></div> <div class="lantern"></div> </div> `)
+//line index.qtpl:386
+	}
+//line index.qtpl:386
+	qw422016.N().S(` <h2>`)
+//line index.qtpl:387
+	qw422016.E().S(theme.title())
+//line index.qtpl:387
+	qw422016.N().S(`</h2> `)
+//line index.qtpl:388
+	if djinnServer != "" {
+//line index.qtpl:388
 		qw422016.N().S(` <a target="_blank" href="`)
-//line index.qtpl:76
-		qw422016.E().S(p.DjinnServer)
-//line index.qtpl:76
+//line index.qtpl:389
+		qw422016.E().S(djinnServer)
+//line index.qtpl:389
 		qw422016.N().S(`">Back to Djinn CI</a> `)
-//line index.qtpl:77
+//line index.qtpl:390
 	}
-//line index.qtpl:77
+//line index.qtpl:390
 	qw422016.N().S(` </div> `)
-//line index.qtpl:79
-	streamrenderTree(qw422016, p.Group, 0, p.Tree)
-//line index.qtpl:79
-	qw422016.N().S(` </div> </body> <footer> <script type="text/javascript"> var els = document.querySelectorAll("[data-accordion]"); var tab = {}; for (var i = 0; i < els.length; i++) { var target = els[i].dataset.accordion; tab[target] = document.querySelector("[data-accordion-body="+target+"]"); } for (var i = 0; i < els.length; i++) { els[i].addEventListener("click", function(e) { e.preventDefault(); if (e.target.dataset.accordion in tab) { var el = tab[e.target.dataset.accordion]; el.hidden = !el.hidden; if (el.hidden) { e.target.classList.remove("accordion-open"); e.target.classList.add("accordion-closed"); } else { e.target.classList.remove("accordion-closed"); e.target.classList.add("accordion-open"); } } }); } </script> </footer> </html> `)
-//line index.qtpl:116
+//line index.qtpl:392
+}
+
+//line index.qtpl:392
+func writerenderTitle(qq422016 qtio422016.Writer, theme *Theme, djinnServer string) {
+//line index.qtpl:392
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:392
+	streamrenderTitle(qw422016, theme, djinnServer)
+//line index.qtpl:392
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:392
+}
+
+//line index.qtpl:392
+func renderTitle(theme *Theme, djinnServer string) string {
+//line index.qtpl:392
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:392
+	writerenderTitle(qb422016, theme, djinnServer)
+//line index.qtpl:392
+	qs422016 := string(qb422016.B)
+//line index.qtpl:392
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:392
+	return qs422016
+//line index.qtpl:392
+}
+
+//line index.qtpl:394
+func streamrenderLinks(qw422016 *qt422016.Writer, theme *Theme) {
+//line index.qtpl:394
+	qw422016.N().S(` `)
+//line index.qtpl:395
+	if len(theme.links()) > 0 {
+//line index.qtpl:395
+		qw422016.N().S(` <div class="links muted"> `)
+//line index.qtpl:397
+		for _, link := range theme.links() {
+//line index.qtpl:397
+			qw422016.N().S(` <a href="`)
+//line index.qtpl:398
+			qw422016.E().S(link.URL)
+//line index.qtpl:398
+			qw422016.N().S(`">`)
+//line index.qtpl:398
+			qw422016.E().S(link.Name)
+//line index.qtpl:398
+			qw422016.N().S(`</a> `)
+//line index.qtpl:399
+		}
+//line index.qtpl:399
+		qw422016.N().S(` </div> `)
+//line index.qtpl:401
+	}
+//line index.qtpl:401
+	qw422016.N().S(` `)
+//line index.qtpl:402
+}
+
+//line index.qtpl:402
+func writerenderLinks(qq422016 qtio422016.Writer, theme *Theme) {
+//line index.qtpl:402
+	qw422016 := qt422016.AcquireWriter(qq422016)
+//line index.qtpl:402
+	streamrenderLinks(qw422016, theme)
+//line index.qtpl:402
+	qt422016.ReleaseWriter(qw422016)
+//line index.qtpl:402
+}
+
+//line index.qtpl:402
+func renderLinks(theme *Theme) string {
+//line index.qtpl:402
+	qb422016 := qt422016.AcquireByteBuffer()
+//line index.qtpl:402
+	writerenderLinks(qb422016, theme)
+//line index.qtpl:402
+	qs422016 := string(qb422016.B)
+//line index.qtpl:402
+	qt422016.ReleaseByteBuffer(qb422016)
+//line index.qtpl:402
+	return qs422016
+//line index.qtpl:402
+}
+
+//line index.qtpl:404
+func (p *Index) StreamRender(qw422016 *qt422016.Writer) {
+//line index.qtpl:404
+	qw422016.N().S(` <!DOCTYPE HTML> <html lang="en"> <head> `)
+//line index.qtpl:408
+	streamrenderHead(qw422016, p.Theme, "")
+//line index.qtpl:408
+	qw422016.N().S(` </head> <body> <div class="content"> `)
+//line index.qtpl:412
+	streamrenderTitle(qw422016, p.Theme, p.DjinnServer)
+//line index.qtpl:412
+	qw422016.N().S(` `)
+//line index.qtpl:413
+	streamrenderSearch(qw422016, p.Search)
+//line index.qtpl:413
+	qw422016.N().S(` `)
+//line index.qtpl:414
+	p.streamrenderFilter(qw422016)
+//line index.qtpl:414
+	qw422016.N().S(` `)
+//line index.qtpl:415
+	p.streamrenderSort(qw422016)
+//line index.qtpl:415
+	qw422016.N().S(` `)
+//line index.qtpl:416
+	p.streamrenderTree(qw422016, 0, p.Tree)
+//line index.qtpl:416
+	qw422016.N().S(` `)
+//line index.qtpl:417
+	streamrenderLinks(qw422016, p.Theme)
+//line index.qtpl:417
+	qw422016.N().S(` </div> </body> <footer> <script type="text/javascript"> /* * The state of the page is kept in the query of the URL, so the * page can be reloaded, or shared, as it is being viewed. Only * block comments can be used, as the template collapses the * script onto a single line. */ var params = new URLSearchParams(window.location.search); function saveState() { var qs = params.toString(); history.replaceState(null, "", window.location.pathname + (qs ? "?" + qs : "")); } var els = document.querySelectorAll("[data-accordion]"); var tab = {}; for (var i = 0; i < els.length; i++) { var target = els[i].dataset.accordion; tab[target] = document.querySelector("[data-accordion-body=\""+target+"\"]"); } function setCollapsed(el, collapsed) { var body = tab[el.dataset.accordion]; if (!body) { return; } body.hidden = collapsed; if (collapsed) { el.classList.remove("accordion-open"); el.classList.add("accordion-closed"); } else { el.classList.remove("accordion-closed"); el.classList.add("accordion-open"); } } function saveCollapsed() { params.delete("collapse"); for (var i = 0; i < els.length; i++) { var body = tab[els[i].dataset.accordion]; if (body && body.hidden) { params.append("collapse", els[i].dataset.accordion); } } saveState(); } for (var i = 0; i < els.length; i++) { els[i].addEventListener("click", function(e) { e.preventDefault(); var body = tab[e.target.dataset.accordion]; if (body) { setCollapsed(e.target, !body.hidden); saveCollapsed(); } }); } var toggles = document.querySelectorAll("[data-collapse-all]"); for (var i = 0; i < toggles.length; i++) { toggles[i].addEventListener("click", function(e) { e.preventDefault(); var collapsed = e.target.dataset.collapseAll == "collapse"; for (var j = 0; j < els.length; j++) { setCollapsed(els[j], collapsed); } saveCollapsed(); }); } var filter = document.querySelector("[data-filter]"); var empty = document.querySelector("[data-filter-empty]"); function applyFilter(val) { val = val.toLowerCase(); var visible = 0; var panels = document.querySelectorAll("[data-panel]"); for (var i = 0; i < panels.length; i++) { var rows = panels[i].querySelectorAll("[data-name]"); var matched = 0; for (var j = 0; j < rows.length; j++) { rows[j].hidden = rows[j].dataset.name.toLowerCase().indexOf(val) < 0; if (!rows[j].hidden) { matched++; } } panels[i].hidden = matched == 0; visible += matched; } empty.hidden = visible > 0; } if (filter) { filter.addEventListener("input", function(e) { applyFilter(e.target.value); if (e.target.value) { params.set("filter", e.target.value); } else { params.delete("filter"); } saveState(); }); filter.form.addEventListener("submit", function(e) { e.preventDefault(); }); } /* * Links that change the filtering, or sorting of the page keep * the state that has changed since the page was loaded. */ var links = document.querySelectorAll("[data-state]"); for (var i = 0; i < links.length; i++) { links[i].addEventListener("click", function(e) { var url = new URL(e.currentTarget.href); ["filter", "collapse"].forEach(function(key) { url.searchParams.delete(key); params.getAll(key).forEach(function(val) { url.searchParams.append(key, val); }); }); e.currentTarget.href = url.toString(); }); } var btns = document.querySelectorAll("[data-copy]"); for (var i = 0; i < btns.length; i++) { btns[i].addEventListener("click", function(e) { e.preventDefault(); var btn = e.target; var text = btn.innerText; navigator.clipboard.writeText(btn.dataset.copy).then(function() { btn.innerText = "Copied"; setTimeout(function() { btn.innerText = text; }, 2000); }); }); } </script> </footer> </html> `)
+//line index.qtpl:592
 }
 
-//line index.qtpl:116
+//line index.qtpl:592
 func (p *Index) WriteRender(qq422016 qtio422016.Writer) {
-//line index.qtpl:116
+//line index.qtpl:592
 	qw422016 := qt422016.AcquireWriter(qq422016)
-//line index.qtpl:116
+//line index.qtpl:592
 	p.StreamRender(qw422016)
-//line index.qtpl:116
+//line index.qtpl:592
 	qt422016.ReleaseWriter(qw422016)
-//line index.qtpl:116
+//line index.qtpl:592
 }
 
-//line index.qtpl:116
+//line index.qtpl:592
 func (p *Index) Render() string {
-//line index.qtpl:116
+//line index.qtpl:592
 	qb422016 := qt422016.AcquireByteBuffer()
-//line index.qtpl:116
+//line index.qtpl:592
 	p.WriteRender(qb422016)
-//line index.qtpl:116
+//line index.qtpl:592
 	qs422016 := string(qb422016.B)
-//line index.qtpl:116
+//line index.qtpl:592
 	qt422016.ReleaseByteBuffer(qb422016)
-//line index.qtpl:116
+//line index.qtpl:592
 	return qs422016
-//line index.qtpl:116
+//line index.qtpl:592
 }
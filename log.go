@@ -1,9 +1,17 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"log/syslog"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type LogLevel uint8
@@ -24,10 +32,12 @@ var LogLevels = map[string]LogLevel{
 }
 
 // Logger is the type for logging information at different levels of severity.
-// The Logger has three logStates representing each level that can be logged at,
-// Debug, Info, and Error.
+// The Logger has four logStates representing each level that can be logged at,
+// Debug, Info, Warn, and Error. Each level can be written to its own set of
+// writers.
 type Logger struct {
-	closer io.Closer
+	closers []io.Closer
+	json    bool
 
 	Debug logState
 	Info  logState
@@ -42,9 +52,12 @@ type Queue struct {
 }
 
 type logState struct {
-	logger *log.Logger
-	level  LogLevel
-	actual LogLevel
+	writers []io.Writer
+	loggers []*log.Logger
+	json    bool
+	level   LogLevel
+	actual  LogLevel
+	fields  []interface{}
 }
 
 // NewLog returns a new Logger that will write to the given io.Writer. This will
@@ -52,75 +65,416 @@ type logState struct {
 // set. The default level of the returned Logger is info.
 func NewLog(wc io.WriteCloser) *Logger {
 	defaultLevel := Info
-	logger := log.New(wc, "", log.Ldate|log.Ltime|log.LUTC)
 
-	return &Logger{
-		closer: wc,
+	l := &Logger{
 		Debug: logState{
-			logger: logger,
 			level:  defaultLevel,
 			actual: Debug,
 		},
 		Info: logState{
-			logger: logger,
 			level:  defaultLevel,
 			actual: Info,
 		},
 		Warn: logState{
-			logger: logger,
 			level:  defaultLevel,
 			actual: Warn,
 		},
 		Error: logState{
-			logger: logger,
 			level:  defaultLevel,
 			actual: Error,
 		},
 	}
+
+	l.SetWriter(wc)
+	return l
+}
+
+func (l *Logger) states() []*logState {
+	return []*logState{&l.Debug, &l.Info, &l.Warn, &l.Error}
 }
 
 // SetLevel sets the level of the logger. The level should be either "debug",
-// "info", or "error". If the given string is none of these values then the
-// logger's level will be unchanged.
+// "info", "warn", or "error". If the given string is none of these values then
+// the logger's level will be unchanged.
 func (l *Logger) SetLevel(s string) {
 	if lvl, ok := LogLevels[strings.ToLower(s)]; ok {
-		l.Debug.level = lvl
-		l.Info.level = lvl
-		l.Error.level = lvl
+		for _, st := range l.states() {
+			st.level = lvl
+		}
+	}
+}
+
+// SetFormat sets the format of each entry written by the logger. The format
+// should be either "text" or "json". If the given string is none of these
+// values then the logger's format will be unchanged.
+func (l *Logger) SetFormat(s string) {
+	switch strings.ToLower(s) {
+	case "text":
+		l.json = false
+	case "json":
+		l.json = true
+	default:
+		return
+	}
+
+	for _, st := range l.states() {
+		st.json = l.json
+		st.setLoggers()
+	}
+}
+
+func (s *logState) setLoggers() {
+	s.loggers = make([]*log.Logger, 0, len(s.writers))
+
+	for _, w := range s.writers {
+		flags := log.Ldate | log.Ltime | log.LUTC
+
+		// Each JSON entry carries its own timestamp, as does each message
+		// sent to syslog, so don't have the stdlib's logger prefix it with
+		// one.
+		if _, ok := w.(*syslog.Writer); ok || s.json {
+			flags = 0
+		}
+		s.loggers = append(s.loggers, log.New(w, "", flags))
+	}
+}
+
+func (l *Logger) addCloser(w io.Writer) {
+	c, ok := w.(io.Closer)
+
+	if !ok {
+		return
 	}
+
+	for _, c2 := range l.closers {
+		if c2 == c {
+			return
+		}
+	}
+	l.closers = append(l.closers, c)
 }
 
-// SetWriter set's the io.Writer for the underlying logger.
+// SetWriter set's the io.Writer for the underlying logger. This replaces the
+// writers of every level.
 func (l *Logger) SetWriter(w io.WriteCloser) {
-	logger := log.New(w, "", log.Ldate|log.Ltime|log.LUTC)
+	l.closers = nil
 
-	l.closer = w
-	l.Debug.logger = logger
-	l.Info.logger = logger
-	l.Warn.logger = logger
-	l.Error.logger = logger
+	for _, st := range l.states() {
+		st.writers = []io.Writer{w}
+		st.setLoggers()
+	}
+	l.addCloser(w)
 }
 
-func (l *Logger) Close() error { return l.closer.Close() }
+// AddWriter adds the io.Writer to the given level. Entries logged at this
+// level will be written to each of the writers added to it.
+func (l *Logger) AddWriter(lvl LogLevel, w io.Writer) {
+	for _, st := range l.states() {
+		if st.actual == lvl {
+			st.writers = append(st.writers, w)
+			st.setLoggers()
+		}
+	}
+	l.addCloser(w)
+}
+
+// ClearWriters removes all of the writers from each level. Nothing will be
+// logged until a writer is added.
+func (l *Logger) ClearWriters() {
+	l.closers = nil
+
+	for _, st := range l.states() {
+		st.writers = nil
+		st.setLoggers()
+	}
+}
+
+// Close closes each of the writers the logger writes to. The standard output
+// and error streams are never closed.
+func (l *Logger) Close() error {
+	var err error
+
+	for _, c := range l.closers {
+		if c == os.Stdout || c == os.Stderr {
+			continue
+		}
+
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+type reopener interface {
+	Reopen() error
+}
+
+// Reopen reopens each file the logger is writing to. This should be called
+// once the files have been rotated by an external program, such as logrotate,
+// so the logger stops writing to the files that were moved.
+func (l *Logger) Reopen() error {
+	var err error
+
+	for _, c := range l.closers {
+		if r, ok := c.(reopener); ok {
+			if rerr := r.Reopen(); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
+
+var logmask = os.O_WRONLY | os.O_APPEND | os.O_CREATE
+
+// LogFile is a file that is written to by a Logger. Once the file exceeds the
+// maximum size, or has been open for longer than the maximum age, it is
+// rotated. Rotation renames the file with the time of rotation as a suffix,
+// and opens a new file in its place. A size or age of zero means the file
+// will never be rotated for that reason.
+type LogFile struct {
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+}
+
+// OpenLogFile opens the file at the given path for appending, creating it if
+// it does not exist.
+func OpenLogFile(path string, maxSize int64, maxAge time.Duration) (*LogFile, error) {
+	f := &LogFile{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *LogFile) open() error {
+	fd, err := os.OpenFile(f.path, logmask, 0640)
+
+	if err != nil {
+		return err
+	}
+
+	info, err := fd.Stat()
+
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	f.f = fd
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// rotatedName returns the name the log file is renamed to when rotated at the
+// given time. The name has the time of rotation as its suffix, and if a file
+// with that name already exists, then a number is appended so an existing file
+// is never overwritten.
+func (f *LogFile) rotatedName(t time.Time) (string, error) {
+	base := f.path + "." + t.UTC().Format("20060102150405.000000")
+
+	for i := 0; i < 100; i++ {
+		name := base
+
+		if i > 0 {
+			name += "." + strconv.Itoa(i)
+		}
+
+		if _, err := os.Lstat(name); os.IsNotExist(err) {
+			return name, nil
+		}
+	}
+	return "", errors.New("cannot rotate " + f.path + ": too many files named " + base)
+}
+
+// rotate renames the file, and opens a new file in its place. The old file is
+// only closed once the new file has been opened, so entries can still be
+// written to the old file should the rotation fail.
+func (f *LogFile) rotate() error {
+	name, err := f.rotatedName(time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.path, name); err != nil {
+		return err
+	}
+
+	old := f.f
+
+	if err := f.open(); err != nil {
+		return err
+	}
+	return old.Close()
+}
+
+func (f *LogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.size > 0 {
+		rotate := f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize
+
+		if f.maxAge > 0 && time.Since(f.opened) > f.maxAge {
+			rotate = true
+		}
+
+		// The entry is still written to the old file should the rotation
+		// fail.
+		if rotate {
+			f.rotate()
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+
+	return n, err
+}
+
+// Reopen opens the file again at the same path, and closes the file it was
+// writing to. If the file cannot be opened again, then the file it was writing
+// to is kept.
+func (f *LogFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old := f.f
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	if old == nil {
+		return nil
+	}
+	return old.Close()
+}
+
+func (f *LogFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		return nil
+	}
+	return f.f.Close()
+}
+
+// With returns a copy of the logState that will attach the given key/value
+// pairs to every entry it logs. A key with no value is given an empty value.
+func (s *logState) With(kv ...interface{}) *logState {
+	if len(kv)%2 != 0 {
+		kv = append(kv, "")
+	}
+
+	s2 := *s
+	s2.fields = make([]interface{}, 0, len(s.fields)+len(kv))
+	s2.fields = append(s2.fields, s.fields...)
+	s2.fields = append(s2.fields, kv...)
+
+	return &s2
+}
+
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func (s *logState) entry(msg string) string {
+	var buf strings.Builder
+
+	if !s.json {
+		buf.WriteString(s.actual.String() + " " + msg)
+
+		for i := 0; i < len(s.fields); i += 2 {
+			val := fmt.Sprint(fieldValue(s.fields[i+1]))
+
+			if val == "" || strings.ContainsAny(val, " \t\n\"=") {
+				val = strconv.Quote(val)
+			}
+			buf.WriteString(" " + fmt.Sprint(s.fields[i]) + "=" + val)
+		}
+		return buf.String()
+	}
+
+	write := func(key string, val interface{}) {
+		b, err := json.Marshal(val)
+
+		if err != nil {
+			b, _ = json.Marshal(fmt.Sprint(val))
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(key)
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(b)
+	}
+
+	write("level", s.actual.String())
+	write("time", time.Now().UTC().Format(time.RFC3339))
+	write("msg", msg)
+
+	for i := 0; i < len(s.fields); i += 2 {
+		write(fmt.Sprint(s.fields[i]), fieldValue(s.fields[i+1]))
+	}
+	return "{" + buf.String() + "}"
+}
+
+func (s *logState) output(msg string) {
+	ent := s.entry(msg)
+
+	for _, logger := range s.loggers {
+		logger.Output(3, ent)
+	}
+}
 
 func (s *logState) Printf(format string, v ...interface{}) {
 	if s.actual < s.level {
 		return
 	}
-	s.logger.Printf(s.actual.String()+" "+format, v...)
+	s.output(fmt.Sprintf(format, v...))
 }
 
 func (s *logState) Println(v ...interface{}) {
 	if s.actual < s.level {
 		return
 	}
-	s.logger.Println(append([]interface{}{s.actual}, v...)...)
+	s.output(strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
 }
 
 func (s *logState) Fatalf(format string, v ...interface{}) {
-	s.logger.Fatalf(s.actual.String()+" "+format, v...)
+	s.output(fmt.Sprintf(format, v...))
+	os.Exit(1)
 }
 
 func (s *logState) Fatal(v ...interface{}) {
-	s.logger.Fatal(append([]interface{}{s.actual, " "}, v...)...)
+	s.output(fmt.Sprint(v...))
+	os.Exit(1)
 }
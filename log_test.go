@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogFileRotateNoClobber(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "imgsrv.log")
+
+	// A maximum size of 1 byte rotates the file on every write after the
+	// first, so many rotations happen within the same second.
+	f, err := OpenLogFile(path, 1, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	entries := []string{"a\n", "b\n", "c\n", "d\n"}
+
+	for _, entry := range entries {
+		if _, err := f.Write([]byte(entry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matches) != len(entries)-1 {
+		t.Fatalf("expected %d rotated files, got %d: %v", len(entries)-1, len(matches), matches)
+	}
+
+	var seen []string
+
+	for _, match := range append(matches, path) {
+		b, err := os.ReadFile(match)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen = append(seen, string(b))
+	}
+
+	for _, entry := range entries {
+		found := false
+
+		for _, s := range seen {
+			if s == entry {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Errorf("entry %q was lost, files contain %q", strings.TrimSpace(entry), seen)
+		}
+	}
+}
+
+func TestLogFileReopenFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "imgsrv.log")
+
+	f, err := OpenLogFile(path, 0, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	// Replace the file with a directory, so it cannot be opened again.
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Reopen(); err == nil {
+		t.Fatal("expected error reopening a directory")
+	}
+
+	if _, err := f.Write([]byte("a\n")); err != nil {
+		t.Fatalf("expected write to the old file, got %s", err)
+	}
+
+	b, err := os.ReadFile(path + ".old")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "a\n" {
+		t.Errorf("expected %q in the old file, got %q", "a\n", string(b))
+	}
+}
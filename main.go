@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -17,6 +18,31 @@ var (
 	Build        string
 )
 
+// gc removes the stale images from the store, as determined by the retention
+// policy in the config.
+func gc(argv0 string, f *os.File, args []string) {
+	var dryrun bool
+
+	fs := flag.NewFlagSet(argv0+" gc", flag.ExitOnError)
+	fs.BoolVar(&dryrun, "dry-run", false, "list the stale images without removing them")
+	fs.Parse(args)
+
+	gc, close, err := DecodeGCConfig(f)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", argv0, err)
+		os.Exit(1)
+	}
+
+	defer close()
+
+	if err := gc.Run(os.Stdout, dryrun); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", argv0, err)
+		close()
+		os.Exit(1)
+	}
+}
+
 func main() {
 	argv0 := os.Args[0]
 
@@ -44,6 +70,15 @@ func main() {
 
 	defer f.Close()
 
+	if args := fs.Args(); len(args) > 0 {
+		if args[0] != "gc" {
+			fmt.Fprintf(os.Stderr, "%s: unknown command %s\n", argv0, args[0])
+			os.Exit(1)
+		}
+		gc(argv0, f, args[1:])
+		return
+	}
+
 	srv, close, err := DecodeConfig(f)
 
 	if err != nil {
@@ -65,10 +100,24 @@ func main() {
 
 	signal.Notify(ch, os.Interrupt)
 
+	reopen := make(chan os.Signal, 1)
+
+	signal.Notify(reopen, syscall.SIGUSR1)
+
+	go func() {
+		for range reopen {
+			if err := srv.Log.Reopen(); err != nil {
+				srv.Log.Error.With("err", err).Println("failed to reopen log")
+				continue
+			}
+			srv.Log.Info.Println("reopened log")
+		}
+	}()
+
 	go func() {
 		if err := srv.Serve(scanCtx); err != nil {
 			if !errors.Is(err, http.ErrServerClosed) {
-				srv.Log.Error.Println("serve error", err)
+				srv.Log.Error.With("err", err).Println("serve error")
 
 				if nerr, ok := err.(net.Error); ok && !nerr.Temporary() {
 					ch <- os.Kill
@@ -78,7 +127,7 @@ func main() {
 		}
 	}()
 
-	srv.Log.Info.Println(argv0, "started on", srv.Addr)
+	srv.Log.Info.With("addr", srv.Addr).Println(argv0, "started")
 
 	sig := <-ch
 
@@ -90,7 +139,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	srv.Log.Info.Println("received signal", sig, "shutting down")
+	srv.Log.Info.With("signal", sig).Println("received signal, shutting down")
 
 	close()
 }
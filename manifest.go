@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is the part of a Djinn CI manifest that uses an image, this is
+// what goes in the .djinn.yml file of a build to run it on the image.
+type Manifest struct {
+	Driver ManifestDriver `json:"driver" yaml:"driver"`
+}
+
+// ManifestDriver is the driver block of a Djinn CI manifest. The arch is the
+// top-level category of the image, and is omitted if the image has no
+// category.
+type ManifestDriver struct {
+	Type  string `json:"type" yaml:"type"`
+	Image string `json:"image" yaml:"image"`
+	Arch  string `json:"arch,omitempty" yaml:"arch,omitempty"`
+}
+
+// newManifest returns the manifest for the given image. If the image was
+// resolved from an alias, then the alias is used as the image's name, so the
+// manifest follows the alias. The arch is only the first part of a nested
+// category, the rest of which prefixes the name of the image, for example the
+// image uefi/alpine/3.17 for the arch x86_64.
+func newManifest(img *Image) Manifest {
+	name := img.Name
+
+	if img.Alias != "" {
+		name = img.Alias
+	}
+
+	arch := img.Category
+
+	if i := strings.Index(arch, "/"); i > 0 {
+		name = arch[i+1:] + "/" + name
+		arch = arch[:i]
+	}
+
+	return Manifest{
+		Driver: ManifestDriver{
+			Type:  img.Driver,
+			Image: name,
+			Arch:  arch,
+		},
+	}
+}
+
+// String returns the manifest as YAML, ready to be pasted into a .djinn.yml
+// file.
+func (m Manifest) String() string {
+	var buf strings.Builder
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(m); err != nil {
+		return ""
+	}
+
+	enc.Close()
+	return buf.String()
+}
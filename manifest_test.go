@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestNewManifest(t *testing.T) {
+	tests := []struct {
+		img      Image
+		expected ManifestDriver
+	}{
+		{
+			Image{Driver: "qemu", Category: "x86_64", Name: "debian/12"},
+			ManifestDriver{Type: "qemu", Image: "debian/12", Arch: "x86_64"},
+		},
+		{
+			Image{Driver: "qemu", Category: "x86_64/uefi", Name: "alpine/3.17"},
+			ManifestDriver{Type: "qemu", Image: "uefi/alpine/3.17", Arch: "x86_64"},
+		},
+		{
+			Image{Driver: "qemu", Category: "x86_64/uefi", Name: "alpine/3.17", Alias: "alpine/latest"},
+			ManifestDriver{Type: "qemu", Image: "uefi/alpine/latest", Arch: "x86_64"},
+		},
+		{
+			Image{Driver: "qemu", Name: "scratch"},
+			ManifestDriver{Type: "qemu", Image: "scratch"},
+		},
+	}
+
+	for _, test := range tests {
+		m := newManifest(&test.img)
+
+		if m.Driver != test.expected {
+			t.Errorf("%s/%s: expected %+v, got %+v", test.img.Category, test.img.Name, test.expected, m.Driver)
+		}
+	}
+
+	if s := newManifest(&Image{Driver: "qemu", Name: "scratch"}).String(); s != "driver:\n  type: qemu\n  image: scratch\n" {
+		t.Errorf("expected no arch for image without a category, got\n%s", s)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+
+	"github.com/andrewpillar/query"
+
+	"gopkg.in/yaml.v3"
+)
+
+// metaExts are the extensions of the sidecar file holding the metadata of an
+// image, along with the function for decoding that file. If an image has more
+// than one then the first is used.
+var metaExts = []struct {
+	ext       string
+	unmarshal func([]byte, interface{}) error
+}{
+	{".meta.json", json.Unmarshal},
+	{".meta.yml", yaml.Unmarshal},
+	{".meta.yaml", yaml.Unmarshal},
+}
+
+// Metadata describes an image, this is read from the sidecar file stored
+// alongside the image.
+type Metadata struct {
+	Description string `json:"description,omitempty" yaml:"description"`
+	OS          string `json:"os,omitempty" yaml:"os"`
+	OSVersion   string `json:"os_version,omitempty" yaml:"os_version"`
+	Kernel      string `json:"kernel,omitempty" yaml:"kernel"`
+	DefaultUser string `json:"default_user,omitempty" yaml:"default_user"`
+	BuildDate   string `json:"build_date,omitempty" yaml:"build_date"`
+}
+
+func (m Metadata) empty() bool { return m == Metadata{} }
+
+// imageMeta is the contents of the sidecar file of an image, for example
+// debian/12.meta.json.
+type imageMeta struct {
+	Metadata `yaml:",inline"`
+
+	Tags []string `json:"tags" yaml:"tags"`
+}
+
+// readMeta reads the metadata for the image at the given path, along with the
+// path of the sidecar file it was read from. If the image has no sidecar file,
+// then empty metadata is returned.
+func readMeta(path string) (imageMeta, string, error) {
+	var meta imageMeta
+
+	for _, sidecar := range metaExts {
+		b, err := os.ReadFile(path + sidecar.ext)
+
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return meta, path + sidecar.ext, err
+		}
+
+		if err := sidecar.unmarshal(b, &meta); err != nil {
+			return meta, path + sidecar.ext, err
+		}
+		return meta, path + sidecar.ext, nil
+	}
+	return meta, "", nil
+}
+
+const insertMeta = `
+INSERT INTO metadata
+(path, description, os, os_version, kernel, default_user, build_date)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+// saveMeta saves the metadata of the given images in the catalog. Like tags,
+// the metadata of an image can change without the image itself being
+// modified, so the metadata of every image is compared against that saved, and
+// only the metadata that differs is replaced. The given images should be every
+// image in the store, as the metadata of any other image is removed.
+func (db DB) saveMeta(imgs []*Image) (err error) {
+	defer sqlitex.Save(db.Conn)(&err)
+
+	nop := func(_ *sqlite.Stmt) error { return nil }
+
+	saved := make(map[string]Metadata)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		saved[stmt.ColumnText(0)] = Metadata{
+			Description: stmt.ColumnText(1),
+			OS:          stmt.ColumnText(2),
+			OSVersion:   stmt.ColumnText(3),
+			Kernel:      stmt.ColumnText(4),
+			DefaultUser: stmt.ColumnText(5),
+			BuildDate:   stmt.ColumnText(6),
+		}
+		return nil
+	}
+
+	q := query.Select(
+		query.Columns("path", "description", "os", "os_version", "kernel", "default_user", "build_date"),
+		query.From("metadata"),
+	)
+
+	if err := sqlitex.Exec(db.Conn, q.Build(), scan, q.Args()...); err != nil {
+		return err
+	}
+
+	paths := make([]interface{}, 0, len(imgs))
+
+	for _, img := range imgs {
+		paths = append(paths, img.Path)
+
+		if saved[img.Path] == img.Meta {
+			continue
+		}
+
+		if err := sqlitex.Exec(db.Conn, "DELETE FROM metadata WHERE (path = $1)", nop, img.Path); err != nil {
+			return err
+		}
+
+		if img.Meta.empty() {
+			continue
+		}
+
+		m := img.Meta
+
+		if err := sqlitex.Exec(db.Conn, insertMeta, nop, img.Path, m.Description, m.OS, m.OSVersion, m.Kernel, m.DefaultUser, m.BuildDate); err != nil {
+			return err
+		}
+	}
+
+	q = query.Delete("metadata", query.Where("path", "NOT IN", query.List(paths...)))
+
+	return sqlitex.Exec(db.Conn, q.Build(), nop, q.Args()...)
+}
+
+// loadMeta sets the metadata for the images in the given set whose paths are
+// in the given list of paths.
+func (db DB) loadMeta(set map[string]*Image, paths []interface{}) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	q := query.Select(
+		query.Columns("path", "description", "os", "os_version", "kernel", "default_user", "build_date"),
+		query.From("metadata"),
+		query.Where("path", "IN", query.List(paths...)),
+	)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		img, ok := set[stmt.ColumnText(0)]
+
+		if !ok {
+			return nil
+		}
+
+		img.Meta = Metadata{
+			Description: stmt.ColumnText(1),
+			OS:          stmt.ColumnText(2),
+			OSVersion:   stmt.ColumnText(3),
+			Kernel:      stmt.ColumnText(4),
+			DefaultUser: stmt.ColumnText(5),
+			BuildDate:   stmt.ColumnText(6),
+		}
+		return nil
+	}
+	return sqlitex.Exec(db.Conn, q.Build(), scan, q.Args()...)
+}
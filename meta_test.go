@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+func TestSaveMeta(t *testing.T) {
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	modTime := time.Now()
+
+	debian := &Image{Path: "/store/qemu/debian/12", Driver: "qemu", Name: "debian/12", ModTime: modTime}
+	alpine := &Image{Path: "/store/qemu/alpine/3.17", Driver: "qemu", Name: "alpine/3.17", ModTime: modTime}
+
+	debian.Meta = Metadata{Description: "Debian Bookworm", OS: "debian"}
+	alpine.Meta = Metadata{Description: "Alpine", OS: "alpine"}
+
+	if err := db.Load([]*Image{debian, alpine}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata of debian changes, and alpine's sidecar file is removed.
+	debian.Meta.OSVersion = "12"
+	alpine.Meta = Metadata{}
+
+	if err := db.Load([]*Image{debian, alpine}); err != nil {
+		t.Fatal(err)
+	}
+
+	imgs, err := db.Images()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, img := range imgs {
+		var expected Metadata
+
+		switch img.Path {
+		case debian.Path:
+			expected = debian.Meta
+		case alpine.Path:
+			expected = alpine.Meta
+		}
+
+		if img.Meta != expected {
+			t.Errorf("%s: expected metadata %+v, got %+v", img.Name, expected, img.Meta)
+		}
+	}
+
+	// Only debian is left with metadata.
+	n, err := sqlitex.ResultInt(db.Conn.Prep("SELECT COUNT(*) FROM metadata"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("expected metadata for 1 image, got %d", n)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// specParam is a parameter of an operation in the OpenAPI document.
+type specParam struct {
+	name        string
+	in          string
+	description string
+	schema      map[string]interface{}
+}
+
+// specOperation is the documentation of an endpoint in the OpenAPI document.
+// The response is the schema of the data in the response envelope.
+type specOperation struct {
+	id          string
+	summary     string
+	description string
+	params      []specParam
+	response    map[string]interface{}
+	errors      []int
+}
+
+func specRef(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"$ref": "#/components/schemas/" + name,
+	}
+}
+
+func specArray(items map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type":  "array",
+		"items": items,
+	}
+}
+
+func specString(format string) map[string]interface{} {
+	schema := map[string]interface{}{
+		"type": "string",
+	}
+
+	if format != "" {
+		schema["format"] = format
+	}
+	return schema
+}
+
+func specInteger() map[string]interface{} {
+	return map[string]interface{}{
+		"type":   "integer",
+		"format": "int64",
+	}
+}
+
+func specEnum(vals ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "string",
+		"enum": vals,
+	}
+}
+
+func specQuery(name, description string, schema map[string]interface{}) specParam {
+	return specParam{
+		name:        name,
+		in:          "query",
+		description: description,
+		schema:      schema,
+	}
+}
+
+func specPath(name, description string) specParam {
+	return specParam{
+		name:        name,
+		in:          "path",
+		description: description,
+		schema:      specString(""),
+	}
+}
+
+var (
+	driverQueryParam = specQuery("driver", "The driver to filter by.", specString(""))
+
+	imageQueryParams = []specParam{
+		specQuery("q", "The name to match, either as a case-insensitive substring, or as a glob if it contains any glob characters.", specString("")),
+		driverQueryParam,
+		specQuery("category", "The category to filter by.", specString("")),
+		specQuery("group", "The group to filter by, this can be given multiple times to match images in any of the groups.", specString("")),
+		specQuery("tag", "The tag to filter by, this can be given multiple times to match images with every tag.", specString("")),
+		specQuery("modified_after", "Only match images modified on or after this date.", specString("date")),
+		specQuery("modified_before", "Only match images modified before this date.", specString("date")),
+		specQuery("min_size", "The minimum size of the images, either in bytes or with a unit, for example 500MB.", specString("")),
+		specQuery("max_size", "The maximum size of the images, either in bytes or with a unit, for example 2GB.", specString("")),
+		specQuery("sort", "The column to sort the images by.", specEnum("name", "mod_time", "size")),
+		specQuery("order", "The direction to sort the images in.", specEnum("asc", "desc")),
+		specQuery("limit", "The maximum number of images in the page.", specInteger()),
+		specQuery("after", "The cursor of the page to return the images after.", specString("")),
+		specQuery("before", "The cursor of the page to return the images before.", specString("")),
+	}
+
+	imagesOperation = specOperation{
+		id:          "listImages",
+		summary:     "List images",
+		description: "Returns the images that match the given query parameters, sorted and paginated. The URLs of the next and previous pages are in the links of the response, and the Link header.",
+		params:      imageQueryParams,
+		response:    specArray(specRef("Image")),
+		errors:      []int{400},
+	}
+
+	imageOperation = specOperation{
+		id:          "getImage",
+		summary:     "Get an image",
+		description: "Returns the metadata of an image. The image is the image's name, prefixed with its category if it has one, for example x86_64/debian/stable.",
+		params: []specParam{
+			specPath("driver", "The driver of the image."),
+			specPath("image", "The category and name of the image."),
+		},
+		response: specRef("Image"),
+		errors:   []int{404},
+	}
+
+	driversOperation = specOperation{
+		id:       "listDrivers",
+		summary:  "List drivers",
+		response: specArray(specRef("Driver")),
+	}
+
+	driverOperation = specOperation{
+		id:      "getDriver",
+		summary: "Get a driver",
+		params: []specParam{
+			specPath("driver", "The name of the driver."),
+		},
+		response: specRef("Driver"),
+		errors:   []int{404},
+	}
+
+	categoriesOperation = specOperation{
+		id:          "listCategories",
+		summary:     "List categories",
+		description: "Returns the categories of each driver, along with the number of images in each category. Nested categories, such as x86_64/uefi, are listed separately, and their images are not counted in the categories they are nested in.",
+		params:      []specParam{driverQueryParam},
+		response:    specArray(specRef("Category")),
+	}
+
+	groupsOperation = specOperation{
+		id:       "listGroups",
+		summary:  "List groups",
+		params:   []specParam{driverQueryParam},
+		response: specArray(specRef("Group")),
+	}
+
+	tagsOperation = specOperation{
+		id:          "listTags",
+		summary:     "List tags",
+		description: "Returns every tag given to an image, along with the number of images with that tag.",
+		response:    specArray(specRef("Tag")),
+	}
+
+	aliasesOperation = specOperation{
+		id:          "listAliases",
+		summary:     "List aliases",
+		description: "Returns the aliases configured for each driver, in each category of the driver, along with the image each alias currently points to.",
+		params:      []specParam{driverQueryParam},
+		response:    specArray(specRef("Alias")),
+	}
+
+	treeOperation = specOperation{
+		id:          "getTree",
+		summary:     "Get the tree of images",
+		description: "Returns the images organized by driver, category, and group, with the number of images beneath each node of the tree.",
+		params:      []specParam{driverQueryParam},
+		response:    specRef("Tree"),
+		errors:      []int{404},
+	}
+)
+
+var specSchemas = map[string]interface{}{
+	"Image": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"driver":         specString(""),
+			"category":       specString(""),
+			"group":          specString(""),
+			"group_rule":     specString(""),
+			"tags":           specArray(specString("")),
+			"meta":           specRef("Metadata"),
+			"manifest":       specRef("Manifest"),
+			"name":           specString(""),
+			"link":           specString(""),
+			"mod_time":       specString("date-time"),
+			"size":           specInteger(),
+			"alias":          specString(""),
+			"target":         specString("uri-reference"),
+			"downloads":      specInteger(),
+			"download_bytes": specInteger(),
+			"last_download": map[string]interface{}{
+				"type":     "string",
+				"format":   "date-time",
+				"nullable": true,
+			},
+			"url": specString("uri-reference"),
+		},
+	},
+	"Driver": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":       specString(""),
+			"categories": specArray(specString("")),
+			"groups":     specArray(specString("")),
+			"images":     specInteger(),
+		},
+	},
+	"Category": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"driver": specString(""),
+			"name":   specString(""),
+			"images": specInteger(),
+		},
+	},
+	"Group": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"driver": specString(""),
+			"name":   specString(""),
+			"images": specInteger(),
+		},
+	},
+	"Metadata": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"description":  specString(""),
+			"os":           specString(""),
+			"os_version":   specString(""),
+			"kernel":       specString(""),
+			"default_user": specString(""),
+			"build_date":   specString(""),
+		},
+	},
+	"Manifest": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"driver": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"type":  specString(""),
+					"image": specString(""),
+					"arch":  specString(""),
+				},
+			},
+		},
+	},
+	"Tag": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":   specString(""),
+			"images": specInteger(),
+		},
+	},
+	"Alias": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"driver":   specString(""),
+			"category": specString(""),
+			"name":     specString(""),
+			"target":   specString(""),
+			"latest":   specString(""),
+			"redirect": map[string]interface{}{"type": "boolean"},
+			"image": map[string]interface{}{
+				"allOf":    []interface{}{specRef("Image")},
+				"nullable": true,
+			},
+		},
+	},
+	"Tree": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":     specString(""),
+			"images":   specInteger(),
+			"children": specArray(specRef("Tree")),
+		},
+	},
+	"Links": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"next": specString("uri-reference"),
+			"prev": specString("uri-reference"),
+		},
+	},
+	"Problem": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type":   specString("uri-reference"),
+			"title":  specString(""),
+			"status": specInteger(),
+			"detail": specString(""),
+		},
+	},
+}
+
+func (op specOperation) build(envelope bool) map[string]interface{} {
+	params := make([]interface{}, 0, len(op.params))
+
+	for _, p := range op.params {
+		param := map[string]interface{}{
+			"name":        p.name,
+			"in":          p.in,
+			"description": p.description,
+			"schema":      p.schema,
+		}
+
+		if p.in == "path" {
+			param["required"] = true
+		}
+		params = append(params, param)
+	}
+
+	schema := op.response
+
+	if envelope {
+		schema = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"data":  op.response,
+				"links": specRef("Links"),
+			},
+		}
+	}
+
+	responses := map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": "OK",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": schema,
+				},
+			},
+		},
+	}
+
+	for _, status := range append(op.errors, 500) {
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content": map[string]interface{}{
+				"application/problem+json": map[string]interface{}{
+					"schema": specRef("Problem"),
+				},
+			},
+		}
+	}
+
+	m := map[string]interface{}{
+		"operationId": op.id,
+		"summary":     op.summary,
+		"parameters":  params,
+		"responses":   responses,
+	}
+
+	if op.description != "" {
+		m["description"] = op.description
+	}
+	return m
+}
+
+// downloadOperation documents the endpoint from which an image is downloaded.
+// This is served by Server.Handle, outside of the API, so its response is not
+// wrapped in an envelope.
+var downloadOperation = specOperation{
+	id:          "downloadImage",
+	summary:     "Download an image",
+	description: "Returns the contents of an image. Range requests are supported for resuming downloads.",
+	params: []specParam{
+		specPath("driver", "The driver of the image."),
+		specPath("image", "The category and name of the image."),
+	},
+	response: map[string]interface{}{
+		"type":   "string",
+		"format": "binary",
+	},
+	errors: []int{404},
+}
+
+// OpenAPI returns the OpenAPI document describing the API, and the endpoint
+// from which images are downloaded. The paths of the document are derived from
+// apiRoutes.
+func OpenAPI() map[string]interface{} {
+	paths := make(map[string]interface{})
+
+	for _, rt := range apiRoutes {
+		path := apiPrefix + strings.Replace(rt.path, "...}", "}", -1)
+
+		paths[path] = map[string]interface{}{
+			"get": rt.op.build(true),
+		}
+	}
+
+	download := downloadOperation.build(false)
+	responses := download["responses"].(map[string]interface{})
+
+	// Errors are served as an HTML page, unless the client asks for JSON.
+	for _, resp := range responses {
+		resp.(map[string]interface{})["content"].(map[string]interface{})["text/html"] = map[string]interface{}{
+			"schema": specString(""),
+		}
+	}
+
+	responses["200"] = map[string]interface{}{
+		"description": "OK",
+		"content": map[string]interface{}{
+			"application/x-qemu-disk": map[string]interface{}{
+				"schema": downloadOperation.response,
+			},
+		},
+	}
+
+	paths["/{driver}/{image}"] = map[string]interface{}{
+		"get": download,
+	}
+
+	version := Build
+
+	if version == "" {
+		version = "devel"
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Djinn CI Image Server",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": specSchemas,
+		},
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/andrewpillar/query"
+)
+
+// sortKey is a column that images can be sorted by, along with the function
+// for retrieving the value of that column from an image for a cursor.
+type sortKey struct {
+	cols []string
+	vals func(*Image) []interface{}
+}
+
+// The driver, category, and name of an image are the final columns of each
+// sort key, these identify the image within the store, and ensure that images
+// with the same value for the column being sorted on are always in the same
+// order, so cursors are stable. The path of the image is never used, so the
+// location of the store is not exposed by a cursor.
+var sortKeys = map[string]sortKey{
+	"": {
+		cols: []string{"driver", "category", "group_name", "name"},
+		vals: func(img *Image) []interface{} {
+			return []interface{}{img.Driver, img.Category, img.Group, img.Name}
+		},
+	},
+	"name": {
+		cols: []string{"name", "driver", "category"},
+		vals: func(img *Image) []interface{} {
+			return []interface{}{img.Name, img.Driver, img.Category}
+		},
+	},
+	"mod_time": {
+		cols: []string{"mod_time", "driver", "category", "name"},
+		vals: func(img *Image) []interface{} {
+			return []interface{}{img.ModTime.Unix(), img.Driver, img.Category, img.Name}
+		},
+	},
+	"size": {
+		cols: []string{"size", "driver", "category", "name"},
+		vals: func(img *Image) []interface{} {
+			return []interface{}{img.Size, img.Driver, img.Category, img.Name}
+		},
+	},
+}
+
+// Page is a page of images in a listing. Pages are navigated with opaque
+// cursors that point to the image either side of the page, so a listing can
+// be paged through reliably even as images are added or removed.
+type Page struct {
+	key    sortKey
+	desc   bool
+	limit  int64
+	after  []interface{}
+	before []interface{}
+
+	Next string
+	Prev string
+}
+
+var errInvalidPage = errors.New("invalid page")
+
+func encodeCursor(vals []interface{}) string {
+	b, _ := json.Marshal(vals)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(key sortKey, s string) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return nil, errInvalidPage
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var vals []interface{}
+
+	if err := dec.Decode(&vals); err != nil {
+		return nil, errInvalidPage
+	}
+
+	if len(vals) != len(key.cols) {
+		return nil, errInvalidPage
+	}
+
+	for i, v := range vals {
+		if n, ok := v.(json.Number); ok {
+			i64, err := n.Int64()
+
+			if err != nil {
+				return nil, errInvalidPage
+			}
+			vals[i] = i64
+		}
+	}
+	return vals, nil
+}
+
+// ParsePage parses the page from the given query parameters. The sort
+// parameter is the column to sort on, either name, mod_time, or size, and the
+// order parameter is the direction, either asc or desc. The limit parameter is
+// the maximum number of images in the page, and the after and before
+// parameters are the cursors to page from. If no limit is given then the page
+// contains every image.
+func ParsePage(q url.Values) (*Page, error) {
+	key, ok := sortKeys[q.Get("sort")]
+
+	if !ok {
+		return nil, errInvalidPage
+	}
+
+	p := &Page{
+		key: key,
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		p.desc = true
+	default:
+		return nil, errInvalidPage
+	}
+
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.ParseInt(s, 10, 64)
+
+		if err != nil || limit < 1 {
+			return nil, errInvalidPage
+		}
+		p.limit = limit
+	}
+
+	var err error
+
+	if s := q.Get("after"); s != "" {
+		if p.after, err = decodeCursor(key, s); err != nil {
+			return nil, err
+		}
+	}
+
+	if s := q.Get("before"); s != "" {
+		if p.before, err = decodeCursor(key, s); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// backwards reports whether the images are being queried in the reverse of
+// the order requested, which is the case when paging to a previous page.
+func (p *Page) backwards() bool { return p.before != nil && p.after == nil }
+
+// Options returns the query options for retrieving the images in the page.
+// This should be given to the query after any WHERE clauses, since these
+// options may add a WHERE clause of their own.
+func (p *Page) Options() []query.Option {
+	opts := make([]query.Option, 0, 4)
+
+	cols := "(" + strings.Join(p.key.cols, ", ") + ")"
+
+	gt, lt := ">", "<"
+
+	if p.desc {
+		gt, lt = lt, gt
+	}
+
+	if p.after != nil {
+		opts = append(opts, query.Where(cols, gt, query.List(p.after...)))
+	}
+
+	if p.before != nil {
+		opts = append(opts, query.Where(cols, lt, query.List(p.before...)))
+	}
+
+	if p.desc != p.backwards() {
+		// The direction of an ORDER BY clause is only applied to the last
+		// column, so apply it to the other columns too.
+		order := make([]string, 0, len(p.key.cols))
+
+		for i, col := range p.key.cols {
+			if i < len(p.key.cols)-1 {
+				col += " DESC"
+			}
+			order = append(order, col)
+		}
+		opts = append(opts, query.OrderDesc(order...))
+	} else {
+		opts = append(opts, query.OrderAsc(p.key.cols...))
+	}
+
+	// Query one more image than the limit, to know if there is another page
+	// after this one.
+	if p.limit > 0 {
+		opts = append(opts, query.Limit(p.limit+1))
+	}
+	return opts
+}
+
+// Images trims the given images to the page, and sets the cursors for the
+// next and previous pages. The given images should have been retrieved with
+// the page's query options.
+func (p *Page) Images(imgs []*Image) []*Image {
+	if p.limit == 0 {
+		return imgs
+	}
+
+	more := int64(len(imgs)) > p.limit
+
+	if more {
+		imgs = imgs[:p.limit]
+	}
+
+	if p.backwards() {
+		for i, j := 0, len(imgs)-1; i < j; i, j = i+1, j-1 {
+			imgs[i], imgs[j] = imgs[j], imgs[i]
+		}
+	}
+
+	if len(imgs) == 0 {
+		return imgs
+	}
+
+	first := encodeCursor(p.key.vals(imgs[0]))
+	last := encodeCursor(p.key.vals(imgs[len(imgs)-1]))
+
+	if p.backwards() {
+		p.Next = last
+
+		if more {
+			p.Prev = first
+		}
+		return imgs
+	}
+
+	if more || p.before != nil {
+		p.Next = last
+	}
+
+	if p.after != nil {
+		p.Prev = first
+	}
+	return imgs
+}
+
+func (p *Page) link(r *http.Request, param, cursor string) string {
+	u := *r.URL
+	q := u.Query()
+
+	q.Del("after")
+	q.Del("before")
+	q.Set(param, cursor)
+
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// Links returns the URLs for the next and previous pages of the given request,
+// keyed by either next or prev.
+func (p *Page) Links(r *http.Request) map[string]string {
+	links := make(map[string]string)
+
+	if p.Next != "" {
+		links["next"] = p.link(r, "after", p.Next)
+	}
+
+	if p.Prev != "" {
+		links["prev"] = p.link(r, "before", p.Prev)
+	}
+	return links
+}
+
+// SetLinkHeader sets the Link header for the next and previous pages of the
+// given request.
+func (p *Page) SetLinkHeader(w http.ResponseWriter, r *http.Request) {
+	links := p.Links(r)
+	header := make([]string, 0, len(links))
+
+	for _, rel := range []string{"next", "prev"} {
+		if link, ok := links[rel]; ok {
+			header = append(header, "<"+link+`>; rel="`+rel+`"`)
+		}
+	}
+
+	if len(header) > 0 {
+		w.Header().Set("Link", strings.Join(header, ", "))
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 )
 
@@ -16,47 +15,160 @@ type ReadSeekCloser interface {
 	io.Closer
 }
 
-type driverGroup struct {
-	name string
-	re   *regexp.Regexp
+// scanError records the path, and driver of the image that could not be
+// scanned.
+type scanError struct {
+	path   string
+	driver string
+	err    error
+}
+
+func (e *scanError) Error() string {
+	return "scan: " + e.path + " - " + e.err.Error()
+}
+
+func (e *scanError) Unwrap() error { return e.err }
+
+// checksumExt is the extension of the file holding the SHA256 checksum of an
+// image, as written by sha256sum.
+const checksumExt = ".sha256"
+
+// sidecarExts are the extensions of the files stored alongside an image that
+// describe the image, these are not scanned as images themselves. These are
+// the checksum, and each of the metadata extensions.
+var sidecarExts = func() []string {
+	exts := []string{checksumExt}
+
+	for _, sidecar := range metaExts {
+		exts = append(exts, sidecar.ext)
+	}
+	return exts
+}()
+
+func isSidecar(path string) bool {
+	for _, ext := range sidecarExts {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
 }
 
 type driver struct {
 	name       string
 	categories map[string]struct{}
 	groups     []driverGroup
+	aliases    []Alias
+
+	// tags are matched in the same way as groups, except an image has every
+	// tag that it matches.
+	tags []driverGroup
+
+	// redirectLinks is whether requests for an image that is a symbolic link
+	// should be redirected to the image it points to.
+	redirectLinks bool
+
+	// cacheControl is the Cache-Control header sent with the images of the
+	// driver.
+	cacheControl string
 }
 
 type Scanner struct {
 	dir     string
+	log     *Logger
 	errh    func(error)
 	drivers map[string]driver
 }
 
-func (s *Scanner) driverHasCategory(driver, category string) bool {
-	if driver, ok := s.drivers[driver]; ok {
-		if _, ok := driver.categories[category]; ok {
-			return true
+// split splits the given path segments into the longest category of the
+// driver that prefixes them, and the remaining segments. Categories can be
+// nested, for example x86_64/uefi, so a category can span multiple segments.
+func (d driver) split(segs []string) (string, []string) {
+	for i := len(segs); i > 0; i-- {
+		category := strings.Join(segs[:i], "/")
+
+		if _, ok := d.categories[category]; ok {
+			return category, segs[i:]
 		}
 	}
-	return false
+	return "", segs
+}
+
+// splitName splits the given path segments of an image into the category of
+// the driver, and the segments of the image's name. The final segment is
+// always part of the name, so it is never considered part of the category.
+func (d driver) splitName(segs []string) (string, []string) {
+	if len(segs) == 0 {
+		return "", segs
+	}
+
+	category, dirs := d.split(segs[:len(segs)-1])
+	return category, append(dirs[:len(dirs):len(dirs)], segs[len(segs)-1])
+}
+
+// split splits the given path segments into the category of the given driver,
+// and the remaining segments.
+func (s *Scanner) split(driver string, segs []string) (string, []string) {
+	if d, ok := s.drivers[driver]; ok {
+		return d.split(segs)
+	}
+	return "", segs
+}
+
+// splitName splits the given path segments of an image into the category of
+// the given driver, and the name of the image.
+func (s *Scanner) splitName(driver string, segs []string) (string, string) {
+	d := s.drivers[driver]
+
+	category, name := d.splitName(segs)
+	return category, strings.Join(name, "/")
 }
 
+// errIncompleteScan is returned by scan when part of the store could not be
+// scanned, so the images returned may be missing some of those in the store.
+var errIncompleteScan = errors.New("scan: store was only partially scanned")
+
+// Scan returns the images in the store. Images that are the target of a
+// symbolic link are not returned, as these are served under the name of the
+// link instead.
 func (s *Scanner) Scan() []*Image {
+	imgs, _, _ := s.scan()
+	return imgs
+}
+
+// scan returns the images in the store, along with the paths of the images that
+// are the target of a symbolic link. Each error that occurs is passed to the
+// Scanner's error handler, and the scan carries on. If any part of the store
+// could not be scanned then errIncompleteScan is returned along with the
+// images that were scanned. A symbolic link to an image that no longer exists
+// is skipped without the scan being incomplete.
+func (s *Scanner) scan() ([]*Image, map[string]struct{}, error) {
 	symlinks := make(map[string]struct{})
 
 	initial := make([]*Image, 0)
 
-	err := filepath.Walk(s.dir, func(path string, info fs.FileInfo, err error) error {
+	var incomplete bool
+
+	filepath.Walk(s.dir, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
-			return err
+			incomplete = true
+			s.errh(&scanError{
+				path: path,
+				err:  err,
+			})
+
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		if info.IsDir() {
+		if info.IsDir() || isSidecar(path) {
 			return nil
 		}
 
 		modtime := info.ModTime()
+		size := info.Size()
 
 		relpath := strings.Replace(path, s.dir+string(os.PathSeparator), "", 1)
 		parts := strings.Split(relpath, string(os.PathSeparator))
@@ -71,69 +183,150 @@ func (s *Scanner) Scan() []*Image {
 			driver, ok = s.drivers[parts[0]]
 
 			if !ok {
-				s.errh(errors.New("scan: " + path + " - invalid driver " + parts[0]))
+				s.errh(&scanError{
+					path:   path,
+					driver: parts[0],
+					err:    errors.New("invalid driver " + parts[0]),
+				})
 				return nil
 			}
 
 			parts = parts[1:]
 
-			if len(parts) >= 1 {
-				if s.driverHasCategory(driver.name, parts[0]) {
-					category = parts[0]
-					parts = parts[1:]
-				}
-			}
+			category, parts = driver.splitName(parts)
 
 			name := strings.Join(parts, string(os.PathSeparator))
 
-			var link, group string
+			var link, target, group string
+
+			var linkCategory string
 
 			if info.Mode().Type() == fs.ModeSymlink {
-				link, _ = os.Readlink(path)
+				link, err = os.Readlink(path)
 
-				linkpath := filepath.Join(filepath.Dir(path), link)
+				if err != nil {
+					incomplete = true
+					s.errh(&scanError{
+						path:   path,
+						driver: driver.name,
+						err:    err,
+					})
+					return nil
+				}
 
-				symlinks[linkpath] = struct{}{}
+				linkpath := link
+
+				if !filepath.IsAbs(link) {
+					linkpath = filepath.Join(filepath.Dir(path), link)
+				}
 
 				info, err := os.Stat(linkpath)
 
 				if err != nil {
-					return err
+					// A link to an image that no longer exists is only
+					// skipped, anything else means the link's target
+					// might not be known.
+					if !errors.Is(err, fs.ErrNotExist) {
+						incomplete = true
+					}
+
+					s.errh(&scanError{
+						path:   path,
+						driver: driver.name,
+						err:    err,
+					})
+					return nil
+				}
+
+				symlinks[linkpath] = struct{}{}
+				target = linkpath
+
+				// The link is named in the same way as the image it points
+				// to, which may be in another category of the driver. A link
+				// to a file outside of the driver is named by the file's
+				// path, as there is no image for it to point to.
+				link = linkpath
+
+				if rel, err := filepath.Rel(filepath.Join(s.dir, driver.name), linkpath); err == nil && !strings.HasPrefix(rel, "..") {
+					var segs []string
+
+					linkCategory, segs = driver.splitName(strings.Split(rel, string(os.PathSeparator)))
+					link = strings.Join(segs, "/")
 				}
 
 				if linktime := info.ModTime(); linktime.After(modtime) {
 					modtime = linktime
 				}
+				size = info.Size()
 			}
 
+			var rule string
+
 			for _, grp := range driver.groups {
-				if grp.re.Match([]byte(name)) {
+				if matched, ok := grp.match(name); ok {
 					group = grp.name
+					rule = matched
+
+					s.log.Debug.With("path", path, "group", group, "rule", rule).Println("matched group")
 					break
 				}
 			}
 
-			if link != "" {
-				link = filepath.Join(filepath.Dir(name), link)
+			tags := make([]string, 0)
+			seen := make(map[string]struct{})
+
+			for _, tag := range driver.tags {
+				if _, ok := tag.match(name); ok {
+					seen[tag.name] = struct{}{}
+					tags = append(tags, tag.name)
+				}
+			}
+
+			// The sidecar files of a link are those of the image it points
+			// to, as they describe the same file.
+			metapath := path
+
+			if target != "" {
+				metapath = target
+			}
+
+			meta, sidecar, err := readMeta(metapath)
+
+			if err != nil {
+				s.errh(&scanError{
+					path:   sidecar,
+					driver: driver.name,
+					err:    err,
+				})
+			}
+
+			for _, tag := range meta.Tags {
+				if _, ok := seen[tag]; !ok && tag != "" {
+					seen[tag] = struct{}{}
+					tags = append(tags, tag)
+				}
 			}
 
 			initial = append(initial, &Image{
-				Path:     path,
-				Driver:   driver.name,
-				Category: category,
-				Group:    group,
-				Name:     name,
-				Link:     link,
-				ModTime:  modtime,
+				Path:      path,
+				Driver:    driver.name,
+				Category:  category,
+				Group:     group,
+				GroupRule: rule,
+				Name:      name,
+				Link:      link,
+				ModTime:   modtime,
+				Size:      size,
+				Tags:      tags,
+				Meta:      meta.Metadata,
+
+				linkCategory: linkCategory,
+				targetPath:   target,
 			})
 		}
 		return nil
 	})
 
-	if err != nil {
-		s.errh(err)
-	}
-
 	imgs := make([]*Image, 0, len(initial))
 
 	for _, img := range initial {
@@ -142,5 +335,9 @@ func (s *Scanner) Scan() []*Image {
 		}
 		imgs = append(imgs, img)
 	}
-	return imgs
+
+	if incomplete {
+		return imgs, symlinks, errIncompleteScan
+	}
+	return imgs, symlinks, nil
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanLinkTargets(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "scratch")
+
+	files := []string{
+		"qemu/x86_64/debian/12",
+		"qemu/x86_64/uefi/alpine/3.17",
+	}
+
+	for _, name := range append(files, outside) {
+		path := name
+
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, filepath.FromSlash(name))
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{
+		"qemu/x86_64/debian/stable": "12",
+		"qemu/x86_64/alpine/latest": "../uefi/alpine/3.17",
+		"qemu/x86_64/scratch":       outside,
+		"qemu/x86_64/broken":        "nope",
+	}
+
+	for name, target := range links {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	log := NewLog(os.Stderr)
+	log.ClearWriters()
+
+	var errs []error
+
+	sc := &Scanner{
+		dir:  dir,
+		log:  log,
+		errh: func(err error) { errs = append(errs, err) },
+		drivers: map[string]driver{
+			"qemu": {
+				name: "qemu",
+				categories: map[string]struct{}{
+					"x86_64":      {},
+					"x86_64/uefi": {},
+				},
+			},
+		},
+	}
+
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := db.Load(sc.Scan()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 1 {
+		t.Errorf("expected 1 error for the broken link, got %v", errs)
+	}
+
+	tests := []struct {
+		name   string
+		link   string
+		target string
+	}{
+		{"debian/stable", "debian/12", "/qemu/x86_64/debian/12"},
+		{"alpine/latest", "alpine/3.17", "/qemu/x86_64/uefi/alpine/3.17"},
+		{"scratch", outside, ""},
+	}
+
+	for _, test := range tests {
+		img, ok, err := db.Image("qemu", "x86_64", test.name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			t.Errorf("%s: expected image", test.name)
+			continue
+		}
+
+		if img.Link != test.link {
+			t.Errorf("%s: expected link %q, got %q", test.name, test.link, img.Link)
+		}
+
+		if img.Target != test.target {
+			t.Errorf("%s: expected target %q, got %q", test.name, test.target, img.Target)
+		}
+	}
+
+	img, ok, err := db.LinkTarget("qemu", "x86_64/uefi", "alpine/3.17")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || img.Endpoint() != "/qemu/x86_64/uefi/alpine/3.17" {
+		t.Errorf("expected link target in x86_64/uefi, got %v", img)
+	}
+}
+
+func TestScanLinkSidecar(t *testing.T) {
+	dir := t.TempDir()
+	debian := filepath.Join(dir, "qemu", "debian")
+
+	if err := os.MkdirAll(debian, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"12":          "debian 12",
+		"12.meta.yml": "description: Debian Bookworm\ntags: [lts]\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(debian, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink("12", filepath.Join(debian, "stable")); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	log := NewLog(os.Stderr)
+	log.ClearWriters()
+
+	sc := &Scanner{
+		dir:  dir,
+		log:  log,
+		errh: func(err error) { t.Error(err) },
+		drivers: map[string]driver{
+			"qemu": {name: "qemu"},
+		},
+	}
+
+	if err := db.Load(sc.Scan()); err != nil {
+		t.Fatal(err)
+	}
+
+	link, ok, err := db.Image("qemu", "", "debian/stable")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("could not find link debian/stable")
+	}
+
+	target, ok, err := db.LinkTarget("qemu", "", "debian/12")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok {
+		t.Fatal("could not find target debian/12")
+	}
+
+	for _, img := range []*Image{link, target} {
+		if img.Meta.Description != "Debian Bookworm" {
+			t.Errorf("%s: expected description %q, got %q", img.Name, "Debian Bookworm", img.Meta.Description)
+		}
+
+		if len(img.Tags) != 1 || img.Tags[0] != "lts" {
+			t.Errorf("%s: expected tags [lts], got %v", img.Name, img.Tags)
+		}
+	}
+}
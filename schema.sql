@@ -1,11 +1,68 @@
 
 
-CREATE TABLE images (
-	path       VARCHAR NOT NULL UNIQUE,
-	driver     VARCHAR NOT NULL,
-	category   VARCHAR NULL,
-	group_name VARCHAR NULL,
-	name       VARCHAR NOT NULL,
-	link       VARCHAR NOT NULL,
-	mod_time   INT NOT NULL
+CREATE TEMP TABLE images (
+	path          VARCHAR NOT NULL UNIQUE,
+	driver        VARCHAR NOT NULL,
+	category      VARCHAR NULL,
+	group_name    VARCHAR NULL,
+	group_rule    VARCHAR NOT NULL DEFAULT '',
+	name          VARCHAR NOT NULL,
+	link          VARCHAR NOT NULL,
+	mod_time      INT NOT NULL,
+	size          INT NOT NULL DEFAULT 0,
+	target        VARCHAR NOT NULL DEFAULT '',
+	link_category VARCHAR NOT NULL DEFAULT ''
+);
+
+CREATE INDEX temp.images_name_idx ON images (name);
+CREATE INDEX temp.images_group_name_idx ON images (group_name);
+CREATE INDEX temp.images_mod_time_idx ON images (mod_time);
+CREATE INDEX temp.images_size_idx ON images (size);
+CREATE INDEX temp.images_link_idx ON images (link);
+
+CREATE TEMP TABLE tags (
+	path VARCHAR NOT NULL,
+	tag  VARCHAR NOT NULL
+);
+
+CREATE INDEX temp.tags_path_idx ON tags (path);
+CREATE INDEX temp.tags_tag_idx ON tags (tag);
+
+CREATE TEMP TABLE metadata (
+	path         VARCHAR NOT NULL UNIQUE,
+	description  VARCHAR NOT NULL,
+	os           VARCHAR NOT NULL,
+	os_version   VARCHAR NOT NULL,
+	kernel       VARCHAR NOT NULL,
+	default_user VARCHAR NOT NULL,
+	build_date   VARCHAR NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS downloads (
+	path          VARCHAR NOT NULL,
+	bytes         INT NOT NULL,
+	complete      BOOLEAN NOT NULL,
+	downloaded_at INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS downloads_path_idx ON downloads (path);
+CREATE INDEX IF NOT EXISTS downloads_downloaded_at_idx ON downloads (downloaded_at);
+
+CREATE TABLE IF NOT EXISTS events (
+	path        VARCHAR NOT NULL,
+	driver      VARCHAR NOT NULL,
+	category    VARCHAR NOT NULL,
+	group_name  VARCHAR NOT NULL,
+	name        VARCHAR NOT NULL,
+	kind        VARCHAR NOT NULL,
+	mod_time    INT NOT NULL,
+	size        INT NOT NULL,
+	recorded_at INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS events_recorded_at_idx ON events (recorded_at);
+
+CREATE TABLE IF NOT EXISTS seen_images (
+	path     VARCHAR NOT NULL UNIQUE,
+	mod_time INT NOT NULL
 );
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andrewpillar/query"
+)
+
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// parseSize parses the given size, which is either a number of bytes, or a
+// number suffixed with the unit, either B, KB, MB, GB, or TB.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+
+	if i < 0 {
+		i = len(s)
+	}
+
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+
+	if !ok {
+		return 0, errors.New("unrecognized size " + s)
+	}
+
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+
+	if err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+// searchOpts returns the query options for searching the images with the
+// given query parameters.
+func searchOpts(q url.Values) ([]query.Option, error) {
+	after, err := parseDate(q.Get("modified_after"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := parseDate(q.Get("modified_before"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	minSize, err := parseSize(q.Get("min_size"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	maxSize, err := parseSize(q.Get("max_size"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []query.Option{
+		WhereName(q.Get("q")),
+		WhereDriver(q.Get("driver")),
+		WhereCategory(q.Get("category")),
+		WhereGroup(q["group"]...),
+		WhereTag(q["tag"]...),
+		WhereModified(after, before),
+		WhereSize(minSize, maxSize),
+	}, nil
+}
+
+// Search serves the images that match the search query parameters, either as
+// JSON or HTML depending on the Accept header. The name is matched via the q
+// parameter, either as a substring or as a glob if it contains any glob
+// characters. The images can be filtered by driver, category, group, and tag,
+// by when they were modified via modified_after and modified_before, each a
+// date in YYYY-MM-DD format, and by size via min_size and max_size.
+func (s *Server) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	opts, err := searchOpts(q)
+
+	if err != nil {
+		s.BadRequest(w, r, err)
+		return
+	}
+
+	s.serveImages(w, r, &Index{Search: q}, opts...)
+}
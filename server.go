@@ -7,6 +7,8 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"time"
@@ -24,9 +26,30 @@ type Server struct {
 	Scanner *Scanner
 
 	ScanInterval time.Duration
+
+	// FeedMaxAge is how long the changes to the store are kept for the feed.
+	FeedMaxAge time.Duration
+
+	// DownloadsMaxAge is how long the downloads of each image are kept for
+	// their statistics.
+	DownloadsMaxAge time.Duration
+
+	// URL is the scheme and host the server is reached at, without a trailing
+	// slash. If empty then the Host of each request is used.
+	URL string
+
+	// Theme is the branding of the web UI.
+	Theme *Theme
 }
 
-func (s *Server) scan(ctx context.Context, imgs chan<- []*Image) {
+// scanResult is the images found by a scan of the store, and whether the whole
+// store was scanned.
+type scanResult struct {
+	imgs     []*Image
+	complete bool
+}
+
+func (s *Server) scan(ctx context.Context, imgs chan<- scanResult) {
 	t := time.NewTicker(s.ScanInterval)
 
 	go func() {
@@ -38,81 +61,308 @@ func (s *Server) scan(ctx context.Context, imgs chan<- []*Image) {
 				t.Stop()
 				return
 			case <-t.C:
-				imgs <- s.Scanner.Scan()
+				scanned, _, err := s.Scanner.scan()
+
+				s.Log.Debug.With("dir", s.Scanner.dir, "count", len(scanned)).Println("scanned images")
+
+				imgs <- scanResult{
+					imgs:     scanned,
+					complete: err == nil,
+				}
 			}
 		}
 	}()
 }
 
+// wantsJSON reports whether the client of the given request wants a JSON
+// response rather than HTML.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+
+	return strings.HasPrefix(accept, "application/json") || strings.HasPrefix(accept, "application/problem+json")
+}
+
+// Error writes an error response with the given status, and detail of the
+// problem. This is a problem as described in RFC 7807 for requests to the API
+// or for JSON, otherwise it is an HTML page.
+func (s *Server) Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	if strings.HasPrefix(r.URL.Path, apiPrefix+"/") || wantsJSON(r) {
+		s.apiError(w, status, detail)
+		return
+	}
+
+	p := &ErrorPage{
+		Problem: Problem{
+			Type:   "about:blank",
+			Title:  http.StatusText(status),
+			Status: status,
+			Detail: detail,
+		},
+		Theme:       s.Theme,
+		DjinnServer: DJINN_SERVER,
+	}
+
+	page := p.Render()
+
+	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(page)), 10))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	if r.Method != http.MethodHead {
+		io.WriteString(w, page)
+	}
+}
+
+func (s *Server) BadRequest(w http.ResponseWriter, r *http.Request, err error) {
+	s.Error(w, r, http.StatusBadRequest, err.Error())
+}
+
+// InternalServerError logs the given error and writes an error response. The
+// error itself is not exposed to the client.
 func (s *Server) InternalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	s.Log.Error.Println(err)
-	w.WriteHeader(http.StatusInternalServerError)
+	s.Log.Error.With("method", r.Method, "path", r.URL.Path, "err", err).Println("internal server error")
+	s.Error(w, r, http.StatusInternalServerError, "")
+}
+
+// NotFound writes an error response for a resource that does not exist, the
+// detail should say which resource, for example "no such image".
+func (s *Server) NotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	s.Error(w, r, http.StatusNotFound, detail)
+}
+
+// route is what the path of a URL resolved to, either an image, or a category
+// of images.
+type route struct {
+	img      *Image
+	alias    *Alias
+	category string
+}
+
+// route resolves the given path segments that follow the driver in a URL. The
+// segments are first resolved to an image in the same way the Scanner names
+// an image, so every image round-trips between its Endpoint and Handle. If
+// there is no such image, then the segments are resolved to a category of the
+// driver. This returns false if the segments are neither.
+func (s *Server) route(driver string, segs []string) (route, bool, error) {
+	category, name := s.Scanner.splitName(driver, segs)
+
+	img, alias, ok, err := s.image(driver, category, name)
+
+	if err != nil {
+		return route{}, false, err
+	}
+
+	if ok {
+		return route{img: img, alias: alias}, true, nil
+	}
+
+	category, rest := s.Scanner.split(driver, segs)
+
+	if len(rest) > 0 {
+		return route{}, false, nil
+	}
+	return route{category: category}, true, nil
+}
+
+// serveDetail serves the HTML page describing the given image. The history of
+// the image is every image in the same directory of the same category.
+func (s *Server) serveDetail(w http.ResponseWriter, r *http.Request, img *Image) {
+	hist := make([]*Image, 0)
+
+	// The history is the other versions of the image, such as debian/11 for
+	// debian/12. An image without a directory in its name, such as scratch,
+	// has no other versions.
+	if dir := path.Dir(img.Name); dir != "." {
+		imgs, err := s.DB.Images(
+			query.Where("driver", "=", query.Arg(img.Driver)),
+			query.Where("category", "=", query.Arg(img.Category)),
+			WhereDir(dir),
+			query.OrderDesc("mod_time DESC", "path"),
+		)
+
+		if err != nil {
+			s.InternalServerError(w, r, err)
+			return
+		}
+		hist = imgs
+	}
+
+	sum, _ := img.Checksum()
+
+	p := &Detail{
+		Image:       img,
+		Checksum:    sum,
+		History:     hist,
+		Theme:       s.Theme,
+		DjinnServer: DJINN_SERVER,
+	}
+
+	page := p.Render()
+
+	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(page)), 10))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, page)
 }
 
-func (s *Server) NotFound(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
+// serveImage serves the given image, or its metadata if JSON is wanted. If
+// the info query parameter is given, then the HTML page describing the image
+// is served instead. The alias is the alias the image was resolved from, if
+// any.
+func (s *Server) serveImage(w http.ResponseWriter, r *http.Request, img *Image, alias *Alias) {
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(img)
+		return
+	}
+
+	if _, ok := r.URL.Query()["info"]; ok {
+		s.serveDetail(w, r, img)
+		return
+	}
+
+	d := s.Scanner.drivers[img.Driver]
+
+	if alias != nil && alias.Redirect {
+		http.Redirect(w, r, img.Endpoint(), http.StatusFound)
+		return
+	}
+
+	if img.Target != "" && d.redirectLinks {
+		http.Redirect(w, r, img.Target, http.StatusFound)
+		return
+	}
+
+	// The ETag is strong, so http.ServeContent can use it for both
+	// If-None-Match, and If-Range when resuming a download.
+	etag, err := img.ETag()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	rsc, err := img.Data()
+
+	if err != nil {
+		s.InternalServerError(w, r, err)
+		return
+	}
+
+	defer rsc.Close()
+
+	dw := &downloadWriter{
+		ResponseWriter: w,
+	}
+
+	dw.Header().Set("Content-Type", "application/x-qemu-disk")
+	dw.Header().Set("ETag", etag)
+
+	if d.cacheControl != "" {
+		dw.Header().Set("Cache-Control", d.cacheControl)
+	}
+	http.ServeContent(dw, r, img.Name, img.ModTime, rsc)
+
+	if r.Method == http.MethodGet {
+		s.recordDownload(dw, img)
+	}
 }
 
 func (s *Server) Handle(w http.ResponseWriter, r *http.Request) {
-	accept := r.Header.Get("Accept")
+	path := r.URL.Path
 
-	parts := strings.Split(r.URL.Path, "/")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	parts := strings.Split(path, "/")
 
 	driver := parts[1]
 
+	if driver != "" {
+		if _, ok := s.Scanner.drivers[driver]; !ok {
+			s.NotFound(w, r, "no such driver "+driver)
+			return
+		}
+	}
+
 	var category string
 
 	if len(parts) > 2 {
-		category = parts[2]
+		rt, ok, err := s.route(driver, parts[2:])
 
-		if len(parts) > 3 {
-			img, ok, err := s.DB.Image(driver, category, strings.Join(parts[3:], "/"))
+		if err != nil {
+			s.InternalServerError(w, r, err)
+			return
+		}
 
-			if err != nil {
-				s.InternalServerError(w, r, err)
-				return
-			}
+		if !ok {
+			s.NotFound(w, r, "no such image "+strings.Join(parts[2:], "/"))
+			return
+		}
 
-			if !ok {
-				s.NotFound(w, r)
-				return
-			}
+		if rt.img != nil {
+			s.serveImage(w, r, rt.img, rt.alias)
+			return
+		}
+		category = rt.category
+	}
 
-			if strings.HasPrefix(accept, "application/json") {
-				json.NewEncoder(w).Encode(img)
-				return
-			}
+	q := r.URL.Query()
 
-			rsc, err := img.Data()
+	opts := []query.Option{
+		WhereDriver(driver),
+		WhereCategory(category),
+		WhereTag(q["tag"]...),
+	}
 
-			if err != nil {
-				s.InternalServerError(w, r, err)
-				return
-			}
+	// The index page leaves out the images of the groups that are not
+	// selected itself, so the headers of those groups can still be shown.
+	if wantsJSON(r) {
+		opts = append(opts, WhereGroup(q["group"]...))
+	}
+	s.serveImages(w, r, &Index{}, opts...)
+}
 
-			defer rsc.Close()
+// serveImages serves the images that match the given query options. The images
+// are served as JSON if the client wants it, whereby they are paginated,
+// otherwise the given index page is rendered with the images, whereby they can
+// only be sorted.
+func (s *Server) serveImages(w http.ResponseWriter, r *http.Request, p *Index, opts ...query.Option) {
+	q := r.URL.Query()
 
-			w.Header().Set("Content-Type", "application/x-qemu-disk")
-			http.ServeContent(w, r, img.Name, img.ModTime, rsc)
-			return
+	isJSON := wantsJSON(r)
+
+	pq := q
+
+	// Only the JSON listing is paginated, the HTML listing can only be
+	// sorted.
+	if !isJSON {
+		pq = url.Values{
+			"sort":  q["sort"],
+			"order": q["order"],
 		}
 	}
 
-	group := r.URL.Query().Get("group")
+	pg, err := ParsePage(pq)
 
-	imgs, err := s.DB.Images(
-		WhereDriver(driver),
-		WhereCategory(category),
-		WhereGroup(group),
-		query.OrderAsc("driver", "category", "group_name", "path"),
-	)
+	if err != nil {
+		s.BadRequest(w, r, err)
+		return
+	}
+
+	imgs, err := s.DB.Images(append(opts, pg.Options()...)...)
 
 	if err != nil {
 		s.InternalServerError(w, r, err)
 		return
 	}
 
-	if strings.HasPrefix(accept, "application/json") {
+	imgs = pg.Images(imgs)
+
+	if isJSON {
+		pg.SetLinkHeader(w, r)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		json.NewEncoder(w).Encode(imgs)
 		return
 	}
@@ -123,11 +373,12 @@ func (s *Server) Handle(w http.ResponseWriter, r *http.Request) {
 		tree.Put(img)
 	}
 
-	p := &Index{
-		Tree:        &tree,
-		DjinnServer: DJINN_SERVER,
-		Group:       group,
-	}
+	p.Tree = &tree
+	p.Theme = s.Theme
+	p.DjinnServer = DJINN_SERVER
+	p.Groups = q["group"]
+	p.Tags = q["tag"]
+	p.Query = q
 
 	page := p.Render()
 
@@ -137,26 +388,69 @@ func (s *Server) Handle(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, page)
 }
 
+// routes returns the handler that routes each request to the endpoint of the
+// server that handles it.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", s.Stats)
+	mux.HandleFunc("/stats/", s.Stats)
+	mux.HandleFunc("/search", s.Search)
+	mux.HandleFunc("/feed", s.Feed)
+	mux.HandleFunc(apiPrefix+"/", s.API)
+	mux.HandleFunc("/", s.Handle)
+
+	return mux
+}
+
 func (s *Server) Serve(ctx context.Context) error {
-	s.Handler = http.HandlerFunc(s.Handle)
+	s.Handler = s.routes()
+
+	sync := make(chan scanResult)
 
-	sync := make(chan []*Image)
+	imgs, _, scanErr := s.Scanner.scan()
 
-	if err := s.DB.Load(s.Scanner.Scan()); err != nil {
-		s.Log.Error.Println("failed to load images", err)
+	if err := s.DB.Load(imgs); err != nil {
+		s.Log.Error.With("count", len(imgs), "err", err).Println("failed to load images")
+	} else {
+		s.Log.Info.With("dir", s.Scanner.dir, "count", len(imgs)).Println("loaded images")
+	}
+
+	// Record the images that changed whilst the server was down. The images
+	// missed by an incomplete scan would be forgotten, and then recorded as
+	// added when next seen, so nothing is recorded until a complete scan.
+	if scanErr != nil {
+		s.Log.Warn.With("dir", s.Scanner.dir).Println("not recording events for incomplete scan")
+	} else if err := s.DB.RecordEvents(imgs); err != nil {
+		s.Log.Error.With("count", len(imgs), "err", err).Println("failed to record events")
 	}
 
 	go func() {
-		for imgs := range sync {
-			s.Log.Debug.Println("syncing", len(imgs), "image(s)")
+		for res := range sync {
+			imgs := res.imgs
+
+			s.Log.Debug.With("count", len(imgs)).Println("syncing images")
 
 			n, err := s.DB.Sync(imgs)
 
 			if err != nil {
-				s.Log.Error.Println("failed to sync images", err)
+				s.Log.Error.With("count", len(imgs), "err", err).Println("failed to sync images")
 				continue
 			}
-			s.Log.Debug.Println("synced", n, "image(s)")
+			s.Log.Debug.With("count", len(imgs), "changed", n).Println("synced images")
+
+			if !res.complete {
+				s.Log.Warn.With("dir", s.Scanner.dir).Println("not recording events for incomplete scan")
+			} else if err := s.DB.RecordEvents(imgs); err != nil {
+				s.Log.Error.With("count", len(imgs), "err", err).Println("failed to record events")
+			}
+
+			if err := s.DB.PruneEvents(time.Now().Add(-s.FeedMaxAge)); err != nil {
+				s.Log.Error.With("err", err).Println("failed to prune events")
+			}
+
+			if err := s.DB.PruneDownloads(time.Now().Add(-s.DownloadsMaxAge)); err != nil {
+				s.Log.Error.With("err", err).Println("failed to prune downloads")
+			}
 		}
 	}()
 
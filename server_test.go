@@ -0,0 +1,312 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testServer returns a Server for a store holding a handful of qemu images, in
+// the x86_64 and x86_64/uefi categories, and without a category.
+func testServer(t *testing.T) *Server {
+	dir := t.TempDir()
+
+	imgs := []string{
+		"qemu/x86_64/debian/11",
+		"qemu/x86_64/debian/12",
+		"qemu/x86_64/debian/13 rc1",
+		"qemu/x86_64/uefi/alpine/3.17",
+		"qemu/scratch",
+	}
+
+	for _, name := range imgs {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	log := NewLog(os.Stderr)
+	log.ClearWriters()
+
+	s := &Server{
+		Server: &http.Server{},
+		DB:     db,
+		Log:    log,
+		Scanner: &Scanner{
+			dir:  dir,
+			log:  log,
+			errh: func(err error) { t.Error(err) },
+			drivers: map[string]driver{
+				"qemu": {
+					name: "qemu",
+					categories: map[string]struct{}{
+						"x86_64":      {},
+						"x86_64/uefi": {},
+					},
+					aliases: []Alias{
+						{Name: "debian/stable", Target: "debian/12"},
+					},
+				},
+			},
+		},
+	}
+
+	if err := db.Load(s.Scanner.Scan()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestServerRoutes(t *testing.T) {
+	s := testServer(t)
+
+	// A driver named after the API prefix should not shadow the API, though
+	// its own images are still served outside of the API.
+	s.Scanner.drivers["api"] = driver{name: "api"}
+
+	h := s.routes()
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		body        string
+	}{
+		{"/qemu/scratch", 200, "application/x-qemu-disk", "qemu/scratch"},
+		{"/qemu/x86_64/debian/12", 200, "application/x-qemu-disk", "qemu/x86_64/debian/12"},
+		{"/qemu/x86_64/uefi/alpine/3.17", 200, "application/x-qemu-disk", "qemu/x86_64/uefi/alpine/3.17"},
+		{"/qemu/x86_64/debian/stable", 200, "application/x-qemu-disk", "qemu/x86_64/debian/12"},
+		{"/qemu/x86_64/debian/13%20rc1", 200, "application/x-qemu-disk", "qemu/x86_64/debian/13 rc1"},
+		{"/qemu/x86_64%2Fdebian%2F12", 200, "application/x-qemu-disk", "qemu/x86_64/debian/12"},
+		{"/qemu", 200, "text/html", ""},
+		{"/qemu/x86_64", 200, "text/html", ""},
+		{"/qemu/x86_64/uefi/", 200, "text/html", ""},
+		{"/api/v1/drivers", 200, "application/json", ""},
+		{"/api/v1/images/qemu/x86_64/debian/12", 200, "application/json", ""},
+		{"/api/v1/nope", 404, "application/problem+json", ""},
+		{"/api", 200, "text/html", ""},
+		{"/nope/x86_64/debian/12", 404, "text/html", ""},
+		{"/qemu/x86_64/debian/1", 404, "text/html", ""},
+		{"/qemu/x86_64/uefi/debian/12", 404, "text/html", ""},
+		{"/qemu/x86_64/debian/13%20rc2", 404, "text/html", ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+
+		h.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.path, test.status, rec.Code)
+			continue
+		}
+
+		typ, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+
+		if err != nil {
+			t.Errorf("%s: %s", test.path, err)
+			continue
+		}
+
+		if typ != test.contentType {
+			t.Errorf("%s: expected Content-Type %s, got %s", test.path, test.contentType, typ)
+		}
+
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%s: expected body %q, got %q", test.path, test.body, rec.Body.String())
+		}
+	}
+}
+
+func TestServerJSON(t *testing.T) {
+	h := testServer(t).routes()
+
+	paths := []string{
+		"/qemu",
+		"/qemu/x86_64",
+		"/qemu/x86_64/debian/12",
+		"/qemu/x86_64/debian/stable",
+		"/search?q=debian",
+	}
+
+	for _, path := range paths {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != 200 {
+			t.Errorf("%s: expected status 200, got %d", path, rec.Code)
+			continue
+		}
+
+		if typ, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type")); typ != "application/json" {
+			t.Errorf("%s: expected Content-Type application/json, got %q", path, typ)
+		}
+	}
+}
+
+// The pages are rendered with collapsed whitespace, so a line comment in a
+// script would comment out the rest of the script.
+func TestServerScripts(t *testing.T) {
+	h := testServer(t).routes()
+
+	script := regexp.MustCompile(`(?s)<script[^>]*>(.*?)</script>`)
+	comment := regexp.MustCompile(`(^|[^:])//`)
+
+	paths := []string{
+		"/qemu",
+		"/qemu/x86_64/debian/12?info",
+	}
+
+	for _, path := range paths {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+		if rec.Code != 200 {
+			t.Errorf("%s: expected status 200, got %d", path, rec.Code)
+			continue
+		}
+
+		matches := script.FindAllStringSubmatch(rec.Body.String(), -1)
+
+		if len(matches) == 0 {
+			t.Errorf("%s: expected script in page", path)
+		}
+
+		for _, m := range matches {
+			if comment.MatchString(m[1]) {
+				t.Errorf("%s: expected no line comments in script, got %q", path, m[1])
+			}
+		}
+	}
+}
+
+func TestServerGroups(t *testing.T) {
+	s := testServer(t)
+
+	debian, err := parseGroupRules([]string{"debian/*"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alpine, err := parseGroupRules([]string{"alpine/*"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drv := s.Scanner.drivers["qemu"]
+	drv.groups = []driverGroup{
+		{name: "Debian", rules: debian},
+		{name: "Alpine", rules: alpine},
+	}
+	s.Scanner.drivers["qemu"] = drv
+
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	if err := db.Load(s.Scanner.Scan()); err != nil {
+		t.Fatal(err)
+	}
+
+	s.DB = db
+
+	rec := httptest.NewRecorder()
+	s.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/qemu?group=Debian", nil))
+
+	if rec.Code != 200 {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+
+	for _, s := range []string{"<h3>Debian</h3>", "<h3>Alpine</h3>", `data-name="debian/12"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected %q in page", s)
+		}
+	}
+
+	for _, s := range []string{`data-name="alpine/3.17"`, `data-name="scratch"`} {
+		if strings.Contains(body, s) {
+			t.Errorf("expected no %q in page", s)
+		}
+	}
+}
+
+func TestServerDetailHistory(t *testing.T) {
+	h := testServer(t).routes()
+
+	tests := []struct {
+		path    string
+		history []string
+	}{
+		{"/qemu/x86_64/debian/12?info", []string{"debian/11", "debian/12", "debian/13 rc1"}},
+		{"/qemu/x86_64/uefi/alpine/3.17?info", []string{"alpine/3.17"}},
+		{"/qemu/scratch?info", nil},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", test.path, nil))
+
+		if rec.Code != 200 {
+			t.Errorf("%s: expected status 200, got %d", test.path, rec.Code)
+			continue
+		}
+
+		body := rec.Body.String()
+
+		i := strings.Index(body, "<h3>History</h3>")
+
+		if test.history == nil {
+			if i >= 0 {
+				t.Errorf("%s: expected no history", test.path)
+			}
+			continue
+		}
+
+		if i < 0 {
+			t.Errorf("%s: expected history", test.path)
+			continue
+		}
+
+		rows := strings.Count(body[i:], `<div class="panel-row">`)
+
+		if rows != len(test.history) {
+			t.Errorf("%s: expected %d images in history, got %d", test.path, len(test.history), rows)
+		}
+
+		for _, name := range test.history {
+			if !strings.Contains(body[i:], name) {
+				t.Errorf("%s: expected %s in history", test.path, name)
+			}
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+
+	"github.com/andrewpillar/query"
+)
+
+// DownloadStat is the number of downloads completed, and the number of bytes
+// served, within a bucket of time.
+type DownloadStat struct {
+	Time      time.Time `json:"time"`
+	Downloads int64     `json:"downloads"`
+	Bytes     int64     `json:"bytes"`
+}
+
+var statBuckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  time.Hour * 24,
+	"week": time.Hour * 24 * 7,
+}
+
+// defaultDownloadsMaxAge is how long downloads are kept for if no maximum age
+// is configured.
+const defaultDownloadsMaxAge = 365 * 24 * time.Hour
+
+var insertDownload = `
+INSERT INTO downloads
+(path, bytes, complete, downloaded_at)
+VALUES ($1, $2, $3, $4)
+`
+
+// RecordDownload records the number of bytes of the image that were served at
+// the given time. If complete is true, then the image was served in its
+// entirety, and is counted as a download.
+func (db DB) RecordDownload(img *Image, bytes int64, complete bool, t time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	nop := func(_ *sqlite.Stmt) error { return nil }
+
+	return sqlitex.Exec(db.Conn, insertDownload, nop, img.Path, bytes, complete, t.Unix())
+}
+
+// PruneDownloads removes the downloads made before the given time.
+func (db DB) PruneDownloads(before time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	nop := func(_ *sqlite.Stmt) error { return nil }
+
+	q := query.Delete("downloads", query.Where("downloaded_at", "<", query.Arg(before.Unix())))
+
+	return sqlitex.Exec(db.Conn, q.Build(), nop, q.Args()...)
+}
+
+// LoadDownloads sets the download statistics for each of the given images.
+func (db DB) LoadDownloads(imgs []*Image) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	set := make(map[string]*Image)
+	paths := make([]interface{}, 0, len(imgs))
+
+	for _, img := range imgs {
+		set[img.Path] = img
+		paths = append(paths, img.Path)
+	}
+	return db.loadDownloads(set, paths)
+}
+
+// loadDownloads sets the download statistics for the images in the given set
+// whose paths are in the given list of paths.
+func (db DB) loadDownloads(set map[string]*Image, paths []interface{}) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	q := query.Select(
+		query.Columns("path", "SUM(complete)", "SUM(bytes)", "MAX(CASE WHEN complete THEN downloaded_at END)"),
+		query.From("downloads"),
+		query.Where("path", "IN", query.List(paths...)),
+	)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		img, ok := set[stmt.ColumnText(0)]
+
+		if !ok {
+			return nil
+		}
+
+		img.Downloads = stmt.ColumnInt64(1)
+		img.DownloadBytes = stmt.ColumnInt64(2)
+
+		// The last download is only that of a complete download, so it
+		// agrees with the number of downloads.
+		if stmt.ColumnType(3) != sqlite.SQLITE_NULL {
+			last := time.Unix(stmt.ColumnInt64(3), 0)
+			img.LastDownload = &last
+		}
+		return nil
+	}
+	return sqlitex.Exec(db.Conn, q.Build()+" GROUP BY path", scan, q.Args()...)
+}
+
+// DownloadHistory returns the download statistics since the given time grouped
+// into buckets of the given duration. If any paths are given, then only the
+// downloads of the images at those paths are counted.
+func (db DB) DownloadHistory(bucket time.Duration, since time.Time, paths ...interface{}) ([]*DownloadStat, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	secs := int64(bucket / time.Second)
+
+	opts := []query.Option{
+		query.From("downloads"),
+		query.Where("downloaded_at", ">=", query.Arg(since.Unix())),
+	}
+
+	if len(paths) > 0 {
+		opts = append(opts, query.Where("path", "IN", query.List(paths...)))
+	}
+
+	q := query.Select(
+		query.Columns(
+			"(downloaded_at / "+strconv.FormatInt(secs, 10)+") AS bucket",
+			"SUM(complete)",
+			"SUM(bytes)",
+		),
+		opts...,
+	)
+
+	stats := make([]*DownloadStat, 0)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		stats = append(stats, &DownloadStat{
+			Time:      time.Unix(stmt.ColumnInt64(0)*secs, 0).UTC(),
+			Downloads: stmt.ColumnInt64(1),
+			Bytes:     stmt.ColumnInt64(2),
+		})
+		return nil
+	}
+
+	if err := sqlitex.Exec(db.Conn, q.Build()+" GROUP BY bucket ORDER BY bucket ASC", scan, q.Args()...); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// downloadWriter records the status and number of bytes written for an image
+// being downloaded.
+type downloadWriter struct {
+	http.ResponseWriter
+
+	status int
+	n      int64
+}
+
+func (w *downloadWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *downloadWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+
+	return n, err
+}
+
+// ReadFrom copies from the given reader to the underlying ResponseWriter, so
+// an image can still be sent via sendfile if the ResponseWriter supports it.
+func (w *downloadWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	var (
+		n   int64
+		err error
+	)
+
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, r)
+	}
+	w.n += n
+
+	return n, err
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (w *downloadWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// complete reports whether the response was written in full, and whether the
+// response covered the entire image. A range that only covers part of the
+// image, such as the final range of a resumed download, is not complete.
+func (w *downloadWriter) complete() (bool, bool) {
+	length, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+
+	if err != nil || w.n != length {
+		return false, false
+	}
+
+	switch w.status {
+	case http.StatusOK:
+		return true, true
+	case http.StatusPartialContent:
+		// Content-Range: bytes <start>-<end>/<size>
+		rng := strings.TrimPrefix(w.Header().Get("Content-Range"), "bytes ")
+
+		i := strings.Index(rng, "-")
+		j := strings.Index(rng, "/")
+
+		if i < 0 || j < i {
+			return true, false
+		}
+
+		start, err := strconv.ParseInt(rng[:i], 10, 64)
+
+		if err != nil {
+			return true, false
+		}
+
+		end, err := strconv.ParseInt(rng[i+1:j], 10, 64)
+
+		if err != nil {
+			return true, false
+		}
+
+		size, err := strconv.ParseInt(rng[j+1:], 10, 64)
+
+		if err != nil {
+			return true, false
+		}
+		return true, start == 0 && end == size-1
+	}
+	return false, false
+}
+
+func (s *Server) recordDownload(w *downloadWriter, img *Image) {
+	written, complete := w.complete()
+
+	if !written {
+		return
+	}
+
+	if err := s.DB.RecordDownload(img, w.n, complete, time.Now()); err != nil {
+		s.Log.Error.With("path", img.Path, "err", err).Println("failed to record download")
+	}
+}
+
+type downloadStats struct {
+	Images  []*Image        `json:"images"`
+	History []*DownloadStat `json:"history"`
+}
+
+// Stats serves the download statistics of the images as JSON. The statistics
+// can be narrowed down to a driver, category, or image in the same way as the
+// image listing, for example /stats/qemu/x86_64. The history of downloads is
+// grouped into buckets of either an hour, day, or week via the bucket query
+// parameter, and goes back as far as the since query parameter, which is a
+// date in YYYY-MM-DD format. By default this returns the last 30 days.
+func (s *Server) Stats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	bucket := statBuckets["day"]
+
+	if name := q.Get("bucket"); name != "" {
+		b, ok := statBuckets[name]
+
+		if !ok {
+			s.Error(w, r, http.StatusBadRequest, "unknown bucket "+name)
+			return
+		}
+		bucket = b
+	}
+
+	since := time.Now().Add(-bucket * 30)
+
+	if val := q.Get("since"); val != "" {
+		t, err := time.Parse("2006-01-02", val)
+
+		if err != nil {
+			s.BadRequest(w, r, err)
+			return
+		}
+		since = t
+	}
+
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/stats"), "/"), "/")
+
+	var (
+		driver   string
+		category string
+		imgs     []*Image
+	)
+
+	if len(parts) > 1 {
+		driver = parts[1]
+
+		if _, ok := s.Scanner.drivers[driver]; driver != "" && !ok {
+			s.NotFound(w, r, "no such driver "+driver)
+			return
+		}
+	}
+
+	var rt route
+
+	if len(parts) > 2 {
+		var (
+			ok  bool
+			err error
+		)
+
+		rt, ok, err = s.route(driver, parts[2:])
+
+		if err != nil {
+			s.InternalServerError(w, r, err)
+			return
+		}
+
+		if !ok {
+			s.NotFound(w, r, "no such image "+strings.Join(parts[2:], "/"))
+			return
+		}
+		category = rt.category
+	}
+
+	if rt.img != nil {
+		imgs = []*Image{rt.img}
+	} else {
+		var err error
+
+		imgs, err = s.DB.Images(
+			WhereDriver(driver),
+			WhereCategory(category),
+			WhereGroup(q.Get("group")),
+			query.OrderAsc("driver", "category", "group_name", "path"),
+		)
+
+		if err != nil {
+			s.InternalServerError(w, r, err)
+			return
+		}
+	}
+
+	hist := make([]*DownloadStat, 0)
+
+	// Only narrow down the history to the images if the statistics were
+	// narrowed down, this way the downloads of images that have since been
+	// removed are still counted.
+	narrowed := driver != "" || q.Get("group") != ""
+
+	if !narrowed || len(imgs) > 0 {
+		paths := make([]interface{}, 0, len(imgs))
+
+		if narrowed {
+			for _, img := range imgs {
+				paths = append(paths, img.Path)
+			}
+		}
+
+		var err error
+
+		hist, err = s.DB.DownloadHistory(bucket, since, paths...)
+
+		if err != nil {
+			s.InternalServerError(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(downloadStats{
+		Images:  imgs,
+		History: hist,
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readerFromRecorder is a ResponseRecorder that reports whether it was copied
+// to via ReadFrom, as the ResponseWriter of the server does for sendfile.
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+
+	readFrom bool
+}
+
+func (w *readerFromRecorder) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+func TestDownloadWriterReadFrom(t *testing.T) {
+	rec := &readerFromRecorder{
+		ResponseRecorder: httptest.NewRecorder(),
+	}
+
+	dw := &downloadWriter{
+		ResponseWriter: rec,
+	}
+
+	const data = "qemu/x86_64/debian/12"
+
+	dw.Header().Set("Content-Length", "21")
+
+	// This is how http.ServeContent copies the image to the ResponseWriter.
+	if _, err := io.CopyN(dw, strings.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+
+	if !rec.readFrom {
+		t.Error("expected the underlying ResponseWriter to be copied to via ReadFrom")
+	}
+
+	if dw.n != int64(len(data)) {
+		t.Errorf("expected %d bytes written, got %d", len(data), dw.n)
+	}
+
+	if written, complete := dw.complete(); !written || !complete {
+		t.Errorf("expected complete download, got written=%v complete=%v", written, complete)
+	}
+
+	if dw.Unwrap() != rec {
+		t.Error("expected Unwrap to return the underlying ResponseWriter")
+	}
+}
+
+func TestPruneDownloads(t *testing.T) {
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	img := &Image{Path: "/store/qemu/debian/12"}
+	now := time.Now()
+
+	if err := db.RecordDownload(img, 10, true, now.AddDate(-2, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.RecordDownload(img, 10, true, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.PruneDownloads(now.Add(-defaultDownloadsMaxAge)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.LoadDownloads([]*Image{img}); err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Downloads != 1 {
+		t.Errorf("expected 1 download after pruning, got %d", img.Downloads)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+
+	"github.com/andrewpillar/query"
+)
+
+const insertTag = `INSERT INTO tags (path, tag) VALUES ($1, $2)`
+
+// saveTags saves the tags of the given images in the catalog. Tags can change
+// without the image itself being modified, so the tags of every image are
+// compared against those saved, and only the tags of the images whose tags
+// differ are replaced. The given images should be every image in the store, as
+// the tags of any other image are removed.
+func (db DB) saveTags(imgs []*Image) (err error) {
+	defer sqlitex.Save(db.Conn)(&err)
+
+	nop := func(_ *sqlite.Stmt) error { return nil }
+
+	saved := make(map[string][]string)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		path := stmt.ColumnText(0)
+		saved[path] = append(saved[path], stmt.ColumnText(1))
+		return nil
+	}
+
+	if err := sqlitex.Exec(db.Conn, "SELECT path, tag FROM tags ORDER BY rowid", scan); err != nil {
+		return err
+	}
+
+	paths := make([]interface{}, 0, len(imgs))
+
+	for _, img := range imgs {
+		paths = append(paths, img.Path)
+
+		if sameTags(saved[img.Path], img.Tags) {
+			continue
+		}
+
+		if err := sqlitex.Exec(db.Conn, "DELETE FROM tags WHERE (path = $1)", nop, img.Path); err != nil {
+			return err
+		}
+
+		for _, tag := range img.Tags {
+			if err := sqlitex.Exec(db.Conn, insertTag, nop, img.Path, tag); err != nil {
+				return err
+			}
+		}
+	}
+
+	q := query.Delete("tags", query.Where("path", "NOT IN", query.List(paths...)))
+
+	return sqlitex.Exec(db.Conn, q.Build(), nop, q.Args()...)
+}
+
+// sameTags reports whether the given lists of tags are the same, and in the
+// same order.
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// loadTags sets the tags for the images in the given set whose paths are in
+// the given list of paths.
+func (db DB) loadTags(set map[string]*Image, paths []interface{}) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	for _, img := range set {
+		img.Tags = make([]string, 0)
+	}
+
+	q := query.Select(
+		query.Columns("path", "tag"),
+		query.From("tags"),
+		query.Where("path", "IN", query.List(paths...)),
+		query.OrderAsc("rowid"),
+	)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		if img, ok := set[stmt.ColumnText(0)]; ok {
+			img.Tags = append(img.Tags, stmt.ColumnText(1))
+		}
+		return nil
+	}
+	return sqlitex.Exec(db.Conn, q.Build(), scan, q.Args()...)
+}
+
+// Tags returns every tag in the catalog, along with the number of images with
+// that tag.
+func (db DB) Tags() (map[string]int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tags := make(map[string]int64)
+
+	scan := func(stmt *sqlite.Stmt) error {
+		tags[stmt.ColumnText(0)] = stmt.ColumnInt64(1)
+		return nil
+	}
+
+	if err := sqlitex.Exec(db.Conn, "SELECT tag, COUNT(*) FROM tags GROUP BY tag", scan); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// WhereTag matches the images that have every one of the given tags.
+func WhereTag(tags ...string) query.Option {
+	return func(q query.Query) query.Query {
+		for _, tag := range tags {
+			if tag == "" {
+				continue
+			}
+
+			q = query.Where("path", "IN", query.Select(
+				query.Columns("path"),
+				query.From("tags"),
+				query.Where("tag", "=", query.Arg(tag)),
+			))(q)
+		}
+		return q
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"crawshaw.io/sqlite"
+	"crawshaw.io/sqlite/sqlitex"
+)
+
+func TestSaveTagsOnlyChanged(t *testing.T) {
+	db, err := InitDB("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+
+	modTime := time.Now()
+
+	debian := &Image{Path: "/store/qemu/debian/12", Driver: "qemu", Name: "debian/12", ModTime: modTime, Tags: []string{"lts"}}
+	alpine := &Image{Path: "/store/qemu/alpine/3.17", Driver: "qemu", Name: "alpine/3.17", ModTime: modTime, Tags: []string{"edge"}}
+
+	if err := db.Load([]*Image{debian, alpine}); err != nil {
+		t.Fatal(err)
+	}
+
+	rowids := func() map[string]int64 {
+		ids := make(map[string]int64)
+
+		scan := func(stmt *sqlite.Stmt) error {
+			ids[stmt.ColumnText(0)] = stmt.ColumnInt64(1)
+			return nil
+		}
+
+		if err := sqlitex.Exec(db.Conn, "SELECT path, rowid FROM tags", scan); err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	// Only the tags of alpine change, and debian is gone from the store.
+	alpine.Tags = []string{"edge", "musl"}
+
+	if err := db.Load([]*Image{alpine}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Sync([]*Image{alpine}); err != nil {
+		t.Fatal(err)
+	}
+
+	after := rowids()
+
+	if _, ok := after[debian.Path]; ok {
+		t.Errorf("expected the tags of %s to be removed", debian.Name)
+	}
+
+	imgs, err := db.Images()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imgs) != 1 || !sameTags(imgs[0].Tags, alpine.Tags) {
+		t.Fatalf("expected %s with tags %v, got %v", alpine.Name, alpine.Tags, imgs)
+	}
+
+	// Nothing changed, so the tags are kept as they are.
+	if err := db.Load([]*Image{alpine}); err != nil {
+		t.Fatal(err)
+	}
+
+	if again := rowids(); again[alpine.Path] != after[alpine.Path] {
+		t.Errorf("expected the tags of %s to be kept, rowid %d became %d", alpine.Name, after[alpine.Path], again[alpine.Path])
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+// defaultTitle is the title of the web UI if no other title is configured.
+const defaultTitle = "Djinn CI Images"
+
+// ThemeLink is a link shown in the footer of the web UI.
+type ThemeLink struct {
+	Name string
+	URL  string
+}
+
+// Theme is the branding of the web UI, this allows operators to replace the
+// title and logo, add their own styles, and add links to the footer. The zero
+// value of a Theme is the default Djinn CI look.
+type Theme struct {
+	Title string
+
+	// Logo is the URL of the image shown in place of the default logo.
+	Logo string
+
+	// CSS is the stylesheet applied after the default styles, so it can
+	// override any of them.
+	CSS string
+
+	Links []ThemeLink
+}
+
+func (t *Theme) title() string {
+	if t == nil || t.Title == "" {
+		return defaultTitle
+	}
+	return t.Title
+}
+
+func (t *Theme) logo() string {
+	if t == nil {
+		return ""
+	}
+	return t.Logo
+}
+
+func (t *Theme) css() string {
+	if t == nil {
+		return ""
+	}
+	return t.CSS
+}
+
+func (t *Theme) links() []ThemeLink {
+	if t == nil {
+		return nil
+	}
+	return t.Links
+}